@@ -0,0 +1,232 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/fatih/structtag"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	auditOperationCreate = "create"
+	auditOperationUpdate = "update"
+	auditOperationDelete = "delete"
+)
+
+// AuditLog is a row of the audit trail bao writes for models tagged
+// bao:",audit". Create the table with:
+//
+//	db.NewCreateTable().Model((*bao.AuditLog)(nil)).Exec(ctx)
+type AuditLog struct {
+	bun.BaseModel `bun:"table:bao_audit_logs"`
+
+	ID        string                 `bun:",pk"`
+	TableName string                 `bun:",notnull"`
+	RecordID  string                 `bun:",notnull"`
+	Operation string                 `bun:",notnull"`
+	Actor     string                 `bun:",nullzero"`
+	Changes   map[string]AuditChange `bun:",type:jsonb,notnull"`
+	CreatedAt time.Time              `bun:",notnull"`
+}
+
+// AuditChange holds the value of a column before and after a write. Old is nil
+// on create and New is nil on delete.
+type AuditChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx that records actor as the author of the
+// writes made with it.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
+
+// isAudited reports whether the model's bun.BaseModel field is tagged
+// bao:",audit".
+func isAudited(table *schema.Table) bool {
+	sf, ok := table.Type.FieldByName("BaseModel")
+	if !ok || sf.Type != reflect.TypeFor[bun.BaseModel]() {
+		return false
+	}
+
+	tags, err := structtag.Parse(string(sf.Tag))
+	if err != nil {
+		return false
+	}
+
+	baoTag, err := tags.Get("bao")
+	if err != nil {
+		return false
+	}
+
+	return baoTag.HasOption("audit")
+}
+
+// loadPrevious loads the persisted state of model, matching on fields, and
+// locks the row for the rest of the transaction. Returns nil if the row does
+// not exist or belongs to another tenant.
+func loadPrevious[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, fields []*schema.Field, model *ModelT) (*ModelT, error) {
+	prev := new(ModelT)
+	query := tx.NewSelect().Model(prev).For("UPDATE")
+
+	strct := reflect.ValueOf(model).Elem()
+	for _, field := range fields {
+		query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, field.SQLName), field.Value(strct).Interface())
+	}
+
+	err := whereTenant(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+
+	err = query.Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errs.Wrap(err, "loading previous model")
+	}
+
+	return prev, nil
+}
+
+// loadPreviousMany is loadPrevious for a batch of models. The result is
+// aligned with models and holds nil for rows that do not exist.
+func loadPreviousMany[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, models []*ModelT) ([]*ModelT, error) {
+	query := tx.NewSelect().Model(&models).WherePK().For("UPDATE")
+
+	err := whereTenant(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*ModelT
+	err = query.Scan(ctx, &rows)
+	if err != nil {
+		return nil, errs.Wrap(err, "loading previous models")
+	}
+
+	byKey := make(map[string]*ModelT, len(rows))
+	for _, row := range rows {
+		byKey[pkKey(table, reflect.ValueOf(row).Elem())] = row
+	}
+
+	prevs := make([]*ModelT, 0, len(models))
+	for _, model := range models {
+		prevs = append(prevs, byKey[pkKey(table, reflect.ValueOf(model).Elem())])
+	}
+
+	return prevs, nil
+}
+
+// diffModels returns the columns whose values differ between prev and next.
+// Either may be nil, in which case every column is part of the diff. Columns
+// tagged bao:",noaudit" are left out.
+func diffModels[ModelT any](table *schema.Table, prev, next *ModelT) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+
+	for _, field := range table.Fields {
+		if fieldHasOption(field, "noaudit") {
+			continue
+		}
+
+		var change AuditChange
+		if prev != nil {
+			change.Old = field.Value(reflect.ValueOf(prev).Elem()).Interface()
+		}
+		if next != nil {
+			change.New = field.Value(reflect.ValueOf(next).Elem()).Interface()
+		}
+
+		if prev != nil && next != nil && reflect.DeepEqual(change.Old, change.New) {
+			continue
+		}
+
+		changes[field.Name] = change
+	}
+
+	return changes
+}
+
+func newAuditLog[ModelT any](ctx context.Context, table *schema.Table, operation string, prev, next *ModelT) *AuditLog {
+	record := next
+	if record == nil {
+		record = prev
+	}
+
+	ids := make([]string, 0, len(table.PKs))
+	for _, pk := range table.PKs {
+		ids = append(ids, fmt.Sprint(pk.Value(reflect.ValueOf(record).Elem()).Interface()))
+	}
+
+	actor, _ := ActorFromContext(ctx)
+
+	return &AuditLog{
+		ID:        uuid.New().String(),
+		TableName: table.Name,
+		RecordID:  strings.Join(ids, ","),
+		Operation: operation,
+		Actor:     actor,
+		Changes:   diffModels(table, prev, next),
+		CreatedAt: now(ctx),
+	}
+}
+
+func writeAuditLogs(ctx context.Context, tx bun.IDB, logs []*AuditLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	_, err := tx.NewInsert().Model(&logs).Exec(ctx)
+	if err != nil {
+		return errs.Wrap(err, "writing audit logs")
+	}
+
+	return nil
+}
+
+func audit[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, operation string, prev, next *ModelT) error {
+	return writeAuditLogs(ctx, tx, []*AuditLog{newAuditLog(ctx, table, operation, prev, next)})
+}
+
+// auditMany writes the audit logs of a batch. prevs or nexts is nil on create
+// and delete respectively, and models without a previous state are skipped on
+// update and delete.
+func auditMany[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, operation string, prevs, nexts []*ModelT) error {
+	n := max(len(prevs), len(nexts))
+	logs := make([]*AuditLog, 0, n)
+
+	for i := range n {
+		var prev, next *ModelT
+		if prevs != nil {
+			prev = prevs[i]
+			if prev == nil {
+				continue
+			}
+		}
+		if nexts != nil {
+			next = nexts[i]
+		}
+
+		logs = append(logs, newAuditLog(ctx, table, operation, prev, next))
+	}
+
+	return writeAuditLogs(ctx, tx, logs)
+}
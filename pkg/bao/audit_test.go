@@ -0,0 +1,200 @@
+package bao
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+type testAuditModel struct {
+	bun.BaseModel `bun:"table:test_audit_models" bao:",audit"`
+
+	ID     string `bun:",pk"`
+	Name   string
+	Secret string `bao:",noaudit"`
+}
+
+func testAuditLogs(t *testing.T, db bun.IDB, recordID string) []*AuditLog {
+	var logs []*AuditLog
+	err := db.NewSelect().Model(&logs).Where("record_id = ?", recordID).Order("created_at").Scan(context.Background())
+	assert.NoError(t, err)
+
+	return logs
+}
+
+func TestCreate_audit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testAuditModel{
+		ID:     uuid.New().String(),
+		Name:   "foo",
+		Secret: "bar",
+	}
+	err := Create(WithActor(context.Background(), "user-1"), db, model, nil, nil)
+	assert.NoError(err)
+
+	logs := testAuditLogs(t, db, model.ID)
+	assert.Len(logs, 1)
+	assert.Equal("test_audit_models", logs[0].TableName)
+	assert.Equal(auditOperationCreate, logs[0].Operation)
+	assert.Equal("user-1", logs[0].Actor)
+	assert.Equal(AuditChange{Old: nil, New: "foo"}, logs[0].Changes["name"])
+	assert.NotContains(logs[0].Changes, "secret")
+}
+
+func TestUpdate_audit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testAuditModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+
+	model.Name = "bar"
+	model.Secret = "baz"
+	err = Update(WithActor(context.Background(), "user-1"), db, model, nil, nil)
+	assert.NoError(err)
+
+	logs := testAuditLogs(t, db, model.ID)
+	assert.Len(logs, 2)
+	assert.Equal(auditOperationUpdate, logs[1].Operation)
+	assert.Equal("user-1", logs[1].Actor)
+	assert.Equal(map[string]AuditChange{
+		"name": {Old: "foo", New: "bar"},
+	}, logs[1].Changes)
+}
+
+func TestUpdateColumns_audit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testAuditModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+
+	// Name is not written, so it is not part of the audited changes.
+	model.Name = "bar"
+	model.Secret = "baz"
+	err = UpdateColumns(context.Background(), db, model, []string{"secret"}, nil, nil)
+	assert.NoError(err)
+
+	logs := testAuditLogs(t, db, model.ID)
+	assert.Len(logs, 2)
+	assert.Equal(auditOperationUpdate, logs[1].Operation)
+	assert.Empty(logs[1].Changes)
+}
+
+func TestUpdate_audit_rollback(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testAuditModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+
+	fnErr := errors.New("test")
+
+	err = Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		model.Name = "bar"
+		err := Update(ctx, tx, model, nil, nil)
+		assert.NoError(err)
+
+		return fnErr
+	})
+	assert.ErrorIs(err, fnErr)
+
+	logs := testAuditLogs(t, db, model.ID)
+	assert.Len(logs, 1)
+}
+
+func TestDelete_audit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testAuditModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, model, nil, nil, nil)
+	assert.NoError(err)
+
+	logs := testAuditLogs(t, db, model.ID)
+	assert.Len(logs, 2)
+	assert.Equal(auditOperationDelete, logs[1].Operation)
+	assert.Empty(logs[1].Actor)
+	assert.Equal(AuditChange{Old: "foo", New: nil}, logs[1].Changes["name"])
+}
+
+func TestUpdateMany_audit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	models := []*testAuditModel{
+		{ID: uuid.New().String(), Name: "foo"},
+		{ID: uuid.New().String(), Name: "bar"},
+	}
+	err := CreateMany(context.Background(), db, models, nil, nil)
+	assert.NoError(err)
+
+	models[0].Name = "baz"
+	err = UpdateMany(context.Background(), db, models, nil, nil)
+	assert.NoError(err)
+
+	logs := testAuditLogs(t, db, models[0].ID)
+	assert.Len(logs, 2)
+	assert.Equal(map[string]AuditChange{
+		"name": {Old: "foo", New: "baz"},
+	}, logs[1].Changes)
+
+	logs = testAuditLogs(t, db, models[1].ID)
+	assert.Len(logs, 2)
+	assert.Empty(logs[1].Changes)
+}
+
+func TestUpsert_audit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testAuditModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	err := Upsert(context.Background(), db, model, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	model.Name = "bar"
+	err = Upsert(context.Background(), db, model, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	logs := testAuditLogs(t, db, model.ID)
+	assert.Len(logs, 2)
+	assert.Equal(auditOperationCreate, logs[0].Operation)
+	assert.Equal(auditOperationUpdate, logs[1].Operation)
+	assert.Equal(map[string]AuditChange{
+		"name": {Old: "foo", New: "bar"},
+	}, logs[1].Changes)
+}
@@ -2,13 +2,13 @@ package bao
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/eleanorhealth/go-common/pkg/bao/hook"
 	"github.com/eleanorhealth/go-common/pkg/errs"
-	"github.com/fatih/structtag"
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/schema"
@@ -29,6 +29,13 @@ func SelectQuery[ModelT any](ctx context.Context, db bun.IDB, model *ModelT) (*b
 		table = query.DB().Table(rType.Elem().Elem())
 	}
 
+	whereNotDeleted(ctx, query, table)
+
+	err := whereTenant(ctx, query, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	return query, table, nil
 }
 
@@ -49,6 +56,10 @@ func SelectForUpdateQuery[ModelT any](ctx context.Context, db bun.IDB, model *Mo
 }
 
 func Find[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.SelectQuery)) ([]*ModelT, error) {
+	return find(ctx, db, queryFn, ModelHooks[ModelT]{})
+}
+
+func find[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.SelectQuery), hooks ModelHooks[ModelT]) ([]*ModelT, error) {
 	var model []*ModelT
 	query, _, err := SelectQuery(ctx, db, &model)
 	if err != nil {
@@ -59,15 +70,53 @@ func Find[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.Selec
 		queryFn(query)
 	}
 
-	err = query.Scan(ctx)
+	err = scan(ctx, db, query, hooks, func() []*ModelT { return model })
 	if err != nil {
-		return nil, errs.Wrap(err, "scanning model")
+		return nil, err
 	}
 
 	return model, nil
 }
 
+// FindAndCount is like Find but applies limit and offset after queryFn and also
+// returns the total number of rows matching queryFn, ignoring limit and offset.
+// The count runs in parallel with the select unless the find hooks or the
+// tenant parameter need a transaction.
+func FindAndCount[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.SelectQuery), limit, offset int) ([]*ModelT, int, error) {
+	var model []*ModelT
+	query, _, err := SelectQuery(ctx, db, &model)
+	if err != nil {
+		return nil, 0, errs.Wrap(err, "select query")
+	}
+
+	if queryFn != nil {
+		queryFn(query)
+	}
+
+	query.Limit(limit).Offset(offset)
+
+	var count int
+	err = runFind(ctx, db, query, ModelHooks[ModelT]{}, func(ctx context.Context) error {
+		var err error
+		count, err = query.ScanAndCount(ctx)
+		if err != nil {
+			return errs.Wrap(err, "scanning and counting model")
+		}
+
+		return nil
+	}, func() []*ModelT { return model })
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return model, count, nil
+}
+
 func FindFirst[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	return findFirst(ctx, db, queryFn, ModelHooks[ModelT]{})
+}
+
+func findFirst[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.SelectQuery), hooks ModelHooks[ModelT]) (*ModelT, error) {
 	var model ModelT
 	query, _, err := SelectQuery(ctx, db, &model)
 	if err != nil {
@@ -78,313 +127,846 @@ func FindFirst[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.
 		queryFn(query)
 	}
 
-	err = query.Scan(ctx)
+	err = scan(ctx, db, query, hooks, func() []*ModelT { return []*ModelT{&model} })
 	if err != nil {
-		return nil, errs.Wrap(err, "scanning model")
+		return nil, err
 	}
 
 	return &model, nil
 }
 
-func FindByID[ModelT any](ctx context.Context, db bun.IDB, id string, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+// FindByID returns the model whose single column primary key is id. IDT can be
+// any type comparable to the primary key column, see validateID.
+func FindByID[ModelT any, IDT any](ctx context.Context, db bun.IDB, id IDT, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	return findByID(ctx, db, id, false, false, queryFn, ModelHooks[ModelT]{})
+}
+
+func FindByIDForUpdate[ModelT any, IDT any](ctx context.Context, db bun.IDB, id IDT, skipLocked bool, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	return findByID(ctx, db, id, true, skipLocked, queryFn, ModelHooks[ModelT]{})
+}
+
+func findByID[ModelT any, IDT any](ctx context.Context, db bun.IDB, id IDT, forUpdate, skipLocked bool, queryFn func(q *bun.SelectQuery), hooks ModelHooks[ModelT]) (*ModelT, error) {
 	var model ModelT
-	query, table, err := SelectQuery(ctx, db, &model)
-	if err != nil {
-		return nil, errs.Wrap(err, "select query")
+
+	var query *bun.SelectQuery
+	var table *schema.Table
+	var err error
+
+	if forUpdate {
+		query, table, err = SelectForUpdateQuery(ctx, db, &model, skipLocked)
+		if err != nil {
+			return nil, errs.Wrap(err, "select for update query")
+		}
+	} else {
+		query, table, err = SelectQuery(ctx, db, &model)
+		if err != nil {
+			return nil, errs.Wrap(err, "select query")
+		}
 	}
 
 	if len(table.PKs) != 1 {
 		return nil, ErrOnePrimaryKey
 	}
 
-	err = validateID(id)
+	err = validateID(&model, table.PKs[0], id)
 	if err != nil {
 		return nil, err
 	}
 
-	query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, table.PKs[0].SQLName), id)
+	query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, table.PKs[0].SQLName), keyArg(table.PKs[0], id))
 
 	if queryFn != nil {
 		queryFn(query)
 	}
 
-	err = query.Scan(ctx)
+	err = scan(ctx, db, query, hooks, func() []*ModelT { return []*ModelT{&model} })
 	if err != nil {
-		return nil, errs.Wrap(err, "scanning model")
+		return nil, err
 	}
 
 	return &model, nil
 }
 
-func FindByIDForUpdate[ModelT any](ctx context.Context, db bun.IDB, id string, skipLocked bool, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+// FindByKey is like FindByID but looks the model up by its full primary key,
+// which may span several columns. key is a []any ordered like the primary key
+// columns, a struct with a field for each primary key column (matched by Go
+// name or bun column name), or, for a single column primary key, the value
+// itself. Each part is validated against the column type and ErrInvalidKey is
+// returned on mismatch.
+func FindByKey[ModelT any](ctx context.Context, db bun.IDB, key any, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
 	var model ModelT
-	query, table, err := SelectForUpdateQuery(ctx, db, &model, skipLocked)
+	query, table, err := SelectQuery(ctx, db, &model)
 	if err != nil {
-		return nil, errs.Wrap(err, "select for update query")
+		return nil, errs.Wrap(err, "select query")
 	}
 
-	if len(table.PKs) != 1 {
-		return nil, ErrOnePrimaryKey
+	err = whereKey(query, table, key)
+	if err != nil {
+		return nil, err
 	}
 
-	err = validateID(id)
+	if queryFn != nil {
+		queryFn(query)
+	}
+
+	err = scan(ctx, db, query, ModelHooks[ModelT]{}, func() []*ModelT { return []*ModelT{&model} })
 	if err != nil {
 		return nil, err
 	}
 
-	query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, table.PKs[0].SQLName), id)
+	return &model, nil
+}
+
+func FindByKeyForUpdate[ModelT any](ctx context.Context, db bun.IDB, key any, skipLocked bool, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	var model ModelT
+	query, table, err := SelectForUpdateQuery(ctx, db, &model, skipLocked)
+	if err != nil {
+		return nil, errs.Wrap(err, "select for update query")
+	}
+
+	err = whereKey(query, table, key)
+	if err != nil {
+		return nil, err
+	}
 
 	if queryFn != nil {
 		queryFn(query)
 	}
 
-	err = query.Scan(ctx)
+	err = scan(ctx, db, query, ModelHooks[ModelT]{}, func() []*ModelT { return []*ModelT{&model} })
 	if err != nil {
-		return nil, errs.Wrap(err, "scanning model")
+		return nil, err
 	}
 
 	return &model, nil
 }
 
+// scan runs query, along with the registered find hooks of ModelT and hooks,
+// see runFind.
+func scan[ModelT any](ctx context.Context, db bun.IDB, query *bun.SelectQuery, hooks ModelHooks[ModelT], models func() []*ModelT) error {
+	return runFind(ctx, db, query, hooks, func(ctx context.Context) error {
+		err := query.Scan(ctx)
+		if err != nil {
+			return errs.Wrap(asNotFound(err), "scanning model")
+		}
+
+		return nil
+	}, models)
+}
+
+// runFind calls exec to run query, along with the registered find hooks of
+// ModelT and hooks. When there are before find hooks, they run in the same
+// transaction as the query so that they can set local parameters for it. The
+// query also runs in a transaction when ctx has a tenant parameter. models
+// returns the models loaded by query, for the after find hooks.
+func runFind[ModelT any](ctx context.Context, db bun.IDB, query *bun.SelectQuery, hooks ModelHooks[ModelT], exec func(ctx context.Context) error, models func() []*ModelT) error {
+	hooks = withRegisteredHooks(hooks)
+
+	run := func(ctx context.Context, db bun.IDB) error {
+		for _, fn := range hooks.BeforeFind {
+			err := fn(ctx, db, query)
+			if err != nil {
+				return errs.Wrap(err, "before find hook")
+			}
+		}
+
+		return exec(ctx)
+	}
+
+	var err error
+	if _, _, ok := tenantParameter(ctx); !ok && len(hooks.BeforeFind) == 0 {
+		err = run(ctx, db)
+	} else {
+		err = Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+			query.Conn(tx)
+			return run(ctx, tx)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range hooks.AfterFind {
+		err := fn(ctx, models())
+		if err != nil {
+			return errs.Wrap(err, "after find hook")
+		}
+	}
+
+	return nil
+}
+
 func Create[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	return create(ctx, db, model, ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters})
+}
+
+func create[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, hooks ModelHooks[ModelT]) error {
 	rType := reflect.TypeFor[*ModelT]()
 	if rType.Elem().Kind() != reflect.Struct {
 		return ErrModelNotStruct
 	}
 
-	err := Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
-		for _, fn := range befores {
+	table := db.Dialect().Tables().Get(rType)
+
+	hooks = withRegisteredHooks(hooks)
+
+	err := setTenant(ctx, table, reflect.ValueOf(model).Elem())
+	if err != nil {
+		return err
+	}
+
+	err = Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		event := &hook.Event[ModelT]{Operation: hook.OperationCreate, Model: model}
+		queueAfters(ctx, hooks.AfterSave, hooks.AfterEvent, event)
+
+		for _, fn := range hooks.BeforeSave {
 			err := fn(ctx, tx, model)
 			if err != nil {
 				return errs.Wrap(err, "before save hook")
 			}
 		}
 
-		_, err := tx.NewInsert().Model(model).Exec(ctx)
+		err := runBeforeEvents(ctx, tx, hooks.BeforeEvent, event, table.Fields)
+		if err != nil {
+			return err
+		}
+
+		err = setCreatedTimestamps(table, reflect.ValueOf(model).Elem(), now(ctx))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(model).Exec(ctx)
 		if err != nil {
 			return errs.Wrap(err, "inserting model")
 		}
 
+		if isAudited(table) {
+			err = audit(ctx, tx, table, auditOperationCreate, nil, model)
+			if err != nil {
+				return err
+			}
+		}
+
 		err = relatedModels(ctx, tx, model, false /* update*/)
 		if err != nil {
 			return errs.Wrap(err, "creating related models")
 		}
 
+		finishEvents(hooks.AfterEvent, []*hook.Event[ModelT]{event}, table.Fields)
+
 		return nil
 	})
 	if err != nil {
-		return err
-	}
-
-	for _, fn := range afters {
-		fn(ctx, model)
+		return asConstraintError(err)
 	}
 
 	return nil
 }
 
 func Update[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	return update(ctx, db, model, nil, ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters})
+}
+
+// UpdateColumns is like Update but only writes the given columns of model,
+// e.g. the fields set by a PATCH request. The version and updatedat columns
+// are always written when the model has them.
+func UpdateColumns[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, columns []string, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	if columns == nil {
+		columns = []string{}
+	}
+
+	return update(ctx, db, model, columns, ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters})
+}
+
+// update writes columns of model, or every column when columns is nil.
+func update[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, columns []string, hooks ModelHooks[ModelT]) error {
 	rType := reflect.TypeFor[*ModelT]()
 	if rType.Elem().Kind() != reflect.Struct {
 		return ErrModelNotStruct
 	}
 
-	err := Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
-		exists, err := tx.NewSelect().Model(model).WherePK().Exists(ctx)
+	table := db.Dialect().Tables().Get(rType)
+
+	hooks = withRegisteredHooks(hooks)
+
+	verField := versionField(table)
+	updatedField := updatedAtField(table)
+
+	fields := updatableFields(table)
+	if columns != nil {
+		var err error
+		fields, err = fieldsByName(table, columns)
 		if err != nil {
-			return errs.Wrap(err, "checking if model exists")
+			return err
+		}
+
+		fields = slices.DeleteFunc(fields, func(field *schema.Field) bool {
+			return field == verField || field == updatedField
+		})
+	}
+
+	// The version and updatedat columns are always written.
+	written := fields
+	if columns != nil {
+		for _, field := range []*schema.Field{verField, updatedField} {
+			if field != nil {
+				written = append(written, field)
+			}
 		}
+	}
+
+	err := setTenant(ctx, table, reflect.ValueOf(model).Elem())
+	if err != nil {
+		return err
+	}
+
+	err = Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		event := &hook.Event[ModelT]{Operation: hook.OperationUpdate, Model: model}
+		queueAfters(ctx, hooks.AfterSave, hooks.AfterEvent, event)
 
-		if !exists {
-			return ErrUpdateNotExists
+		if isAudited(table) || hooks.hasEvents() {
+			prev, err := loadPrevious(ctx, tx, table, table.PKs, model)
+			if err != nil {
+				return err
+			}
+
+			if prev == nil {
+				return ErrUpdateNotExists
+			}
+
+			event.Previous = prev
+		} else {
+			query := tx.NewSelect().Model(model).WherePK()
+
+			err := whereTenant(ctx, query, table)
+			if err != nil {
+				return err
+			}
+
+			exists, err := query.Exists(ctx)
+			if err != nil {
+				return errs.Wrap(err, "checking if model exists")
+			}
+
+			if !exists {
+				return ErrUpdateNotExists
+			}
 		}
 
-		for _, fn := range befores {
+		for _, fn := range hooks.BeforeSave {
 			err := fn(ctx, tx, model)
 			if err != nil {
 				return errs.Wrap(err, "before save hook")
 			}
 		}
 
-		_, err = tx.NewUpdate().Model(model).WherePK().Exec(ctx)
+		err := runBeforeEvents(ctx, tx, hooks.BeforeEvent, event, fields)
 		if err != nil {
-			return errs.Wrap(err, "updating model")
+			return err
 		}
 
-		err = relatedModels(ctx, tx, model, false /* update*/)
+		// Only the related models are left to write.
+		if len(written) == 0 {
+			return persistUpdated(ctx, tx, table, hooks, event, written)
+		}
+
+		err = setUpdatedTimestamp(table, reflect.ValueOf(model).Elem(), now(ctx))
 		if err != nil {
-			return errs.Wrap(err, "updating related models")
+			return err
 		}
 
-		return nil
+		query := tx.NewUpdate().Model(model).WherePK()
+
+		err = whereTenant(ctx, query, table)
+		if err != nil {
+			return err
+		}
+
+		if columns != nil {
+			names := make([]string, 0, len(written))
+			for _, field := range written {
+				names = append(names, field.Name)
+			}
+
+			query.Column(names...)
+		} else if createdField := createdAtField(table); createdField != nil {
+			query.ExcludeColumn(createdField.Name)
+		}
+
+		if verField != nil {
+			oldVersion, err := bumpVersion(ctx, verField, reflect.ValueOf(model).Elem())
+			if err != nil {
+				return err
+			}
+
+			query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, verField.SQLName), oldVersion)
+		}
+
+		res, err := query.Exec(ctx)
+		if err != nil {
+			return errs.Wrap(err, "updating model")
+		}
+
+		if verField != nil {
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return errs.Wrap(err, "getting rows affected")
+			}
+
+			if affected == 0 {
+				return ErrStaleModel
+			}
+		}
+
+		return persistUpdated(ctx, tx, table, hooks, event, written)
 	})
 	if err != nil {
-		return err
+		return asConstraintError(err)
 	}
 
-	for _, fn := range afters {
-		fn(ctx, model)
+	return nil
+}
+
+// persistUpdated audits the update of the model of event and writes its related
+// models.
+func persistUpdated[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, hooks ModelHooks[ModelT], event *hook.Event[ModelT], written []*schema.Field) error {
+	if isAudited(table) {
+		// Columns that were not written can differ between model and the
+		// stored row, so the stored row is audited.
+		next, err := loadPrevious(ctx, tx, table, table.PKs, event.Model)
+		if err != nil {
+			return err
+		}
+
+		err = audit(ctx, tx, table, auditOperationUpdate, event.Previous, next)
+		if err != nil {
+			return err
+		}
 	}
 
+	err := relatedModels(ctx, tx, event.Model, false /* update*/)
+	if err != nil {
+		return errs.Wrap(err, "updating related models")
+	}
+
+	finishEvents(hooks.AfterEvent, []*hook.Event[ModelT]{event}, written)
+
 	return nil
 }
 
-func Delete[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, queryFn func(q *bun.DeleteQuery), befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+// Upsert inserts model or, when a row conflicting on conflictColumns already
+// exists, updates updateColumns of that row (INSERT ... ON CONFLICT ... DO
+// UPDATE). conflictColumns defaults to the primary key and updateColumns
+// defaults to every other column. An empty updateColumns leaves an existing row
+// alone (DO NOTHING), in which case the related models of model are not written
+// and the after hooks do not run.
+func Upsert[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, conflictColumns []string, updateColumns []string, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
 	rType := reflect.TypeFor[*ModelT]()
 	if rType.Elem().Kind() != reflect.Struct {
 		return ErrModelNotStruct
 	}
 
-	err := Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
-		for _, fn := range befores {
+	table := db.Dialect().Tables().Get(rType)
+
+	hooks := withRegisteredHooks(ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters})
+
+	conflictFields := table.PKs
+	if len(conflictColumns) > 0 {
+		var err error
+		conflictFields, err = fieldsByName(table, conflictColumns)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(conflictFields) == 0 {
+		return ErrNoConflictColumns
+	}
+
+	createdField := createdAtField(table)
+	updatedField := updatedAtField(table)
+	verField := versionField(table)
+
+	var updateFields []*schema.Field
+	if updateColumns != nil {
+		var err error
+		updateFields, err = fieldsByName(table, updateColumns)
+		if err != nil {
+			return err
+		}
+
+		// An empty list means DO NOTHING, which leaves updated_at alone.
+		if updatedField != nil && len(updateFields) > 0 && !slices.Contains(updateFields, updatedField) {
+			updateFields = append(updateFields, updatedField)
+		}
+	} else {
+		for _, field := range table.Fields {
+			if !slices.Contains(conflictFields, field) && !field.IsPK && field != createdField {
+				updateFields = append(updateFields, field)
+			}
+		}
+	}
+
+	// The version column is checked and bumped rather than overwritten.
+	updateFields = slices.DeleteFunc(updateFields, func(field *schema.Field) bool {
+		return field == verField
+	})
+
+	tenant := tenantField(table)
+
+	err := setTenant(ctx, table, reflect.ValueOf(model).Elem())
+	if err != nil {
+		return err
+	}
+
+	err = Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		event := &hook.Event[ModelT]{Operation: hook.OperationCreate, Model: model}
+
+		for _, fn := range hooks.BeforeSave {
 			err := fn(ctx, tx, model)
 			if err != nil {
-				return errs.Wrap(err, "before delete hook")
+				return errs.Wrap(err, "before save hook")
 			}
 		}
 
-		query := tx.NewDelete().Model(model)
+		var prev *ModelT
+		if isAudited(table) || hooks.hasEvents() {
+			var err error
+			prev, err = loadPrevious(ctx, tx, table, conflictFields, model)
+			if err != nil {
+				return err
+			}
+		}
 
-		if queryFn != nil {
-			queryFn(query)
+		written := table.Fields
+		if prev != nil {
+			event.Operation = hook.OperationUpdate
+			event.Previous = prev
+			written = updateFields
+
+			if verField != nil && len(updateFields) > 0 {
+				written = append(slices.Clip(updateFields), verField)
+			}
+		}
+
+		err := runBeforeEvents(ctx, tx, hooks.BeforeEvent, event, written)
+		if err != nil {
+			return err
+		}
+
+		err = setCreatedTimestamps(table, reflect.ValueOf(model).Elem(), now(ctx))
+		if err != nil {
+			return err
+		}
+
+		query := tx.NewInsert().Model(model)
+
+		conflictNames := make([]string, 0, len(conflictFields))
+		for _, field := range conflictFields {
+			conflictNames = append(conflictNames, string(field.SQLName))
+		}
+
+		if len(updateFields) == 0 {
+			query.On(fmt.Sprintf("CONFLICT (%s) DO NOTHING", strings.Join(conflictNames, ", ")))
 		} else {
-			query.WherePK()
+			query.On(fmt.Sprintf("CONFLICT (%s) DO UPDATE", strings.Join(conflictNames, ", ")))
+
+			for _, field := range updateFields {
+				query.Set(fmt.Sprintf("%s = EXCLUDED.%s", field.SQLName, field.SQLName))
+			}
+
+			// Only the version the model was read with may be updated.
+			if verField != nil {
+				query.Set(fmt.Sprintf("%s = %s.%s + 1", verField.SQLName, table.SQLAlias, verField.SQLName))
+				query.Where(fmt.Sprintf("%s.%s = EXCLUDED.%s", table.SQLAlias, verField.SQLName, verField.SQLName))
+			}
+
+			// Never take over the conflicting row of another tenant.
+			if tenant != nil {
+				query.Where(fmt.Sprintf("%s.%s = EXCLUDED.%s", table.SQLAlias, tenant.SQLName, tenant.SQLName))
+			}
+		}
+
+		query.Returning(upsertReturning(table, reflect.ValueOf(model).Elem()))
+
+		// RETURNING reads the bumped version into model.
+		if verField != nil {
+			restoreOnRollback(ctx, verField, reflect.ValueOf(model).Elem())
 		}
 
-		_, err := query.Exec(ctx)
+		res, err := query.Exec(ctx)
 		if err != nil {
-			return errs.Wrap(err, "deleting model")
+			return errs.Wrap(err, "upserting model")
 		}
 
-		err = relatedModels(ctx, tx, model, true /*delete*/)
+		affected, err := res.RowsAffected()
 		if err != nil {
-			return errs.Wrap(err, "deleting related models")
+			return errs.Wrap(err, "getting rows affected")
+		}
+
+		if affected == 0 {
+			// The conflicting row was left alone, because of DO NOTHING,
+			// because it belongs to another tenant or because its version
+			// does not match.
+			if tenant != nil {
+				existing, err := loadPrevious(ctx, tx, table, conflictFields, model)
+				if err != nil {
+					return err
+				}
+
+				if existing == nil {
+					return ErrTenantMismatch
+				}
+			}
+
+			if len(updateFields) > 0 {
+				return ErrStaleModel
+			}
+
+			// Neither the existing row nor its related models are written.
+			return nil
 		}
 
+		queueAfters(ctx, hooks.AfterSave, hooks.AfterEvent, event)
+
+		if isAudited(table) && (prev == nil || len(updateFields) > 0) {
+			// The stored row can differ from model when only some columns are
+			// updated on conflict.
+			next, err := loadPrevious(ctx, tx, table, conflictFields, model)
+			if err != nil {
+				return err
+			}
+
+			operation := auditOperationUpdate
+			if prev == nil {
+				operation = auditOperationCreate
+			}
+
+			err = audit(ctx, tx, table, operation, prev, next)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = relatedModels(ctx, tx, model, false /* update*/)
+		if err != nil {
+			return errs.Wrap(err, "upserting related models")
+		}
+
+		finishEvents(hooks.AfterEvent, []*hook.Event[ModelT]{event}, written)
+
 		return nil
 	})
 	if err != nil {
-		return err
-	}
-
-	for _, fn := range afters {
-		fn(ctx, model)
+		return asConstraintError(err)
 	}
 
 	return nil
 }
 
-func Trx(ctx context.Context, db bun.IDB, fn func(ctx context.Context, tx bun.IDB) error) error {
-	var tx bun.Tx
-	var err error
-	var commit bool
+// upsertReturning returns the RETURNING list of an upsert of strct. It holds
+// the primary key, which is the key of the existing row when a conflict on
+// other columns updates it, the version column, which is bumped on update, and
+// the columns bun returns itself because they are written as their default.
+func upsertReturning(table *schema.Table, strct reflect.Value) string {
+	verField := versionField(table)
 
-	switch db := db.(type) {
-	case bun.Tx:
-		tx = db
+	names := make([]string, 0, len(table.PKs))
+	for _, field := range table.Fields {
+		isDefault := (field.IsPtr && field.HasNilValue(strct)) ||
+			(field.HasZeroValue(strct) && (field.NullZero || field.SQLDefault != "" || field.AutoIncrement))
 
-	case *bun.DB:
-		tx, err = db.BeginTx(ctx, nil)
-		if err != nil {
-			return errs.Wrap(err, "beginning transaction")
+		if field.IsPK || field == verField || isDefault {
+			names = append(names, string(field.SQLName))
 		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func Delete[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, queryFn func(q *bun.DeleteQuery), befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	return deleteModel(ctx, db, model, queryFn, ModelHooks[ModelT]{BeforeDelete: befores, AfterDelete: afters})
+}
+
+func deleteModel[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, queryFn func(q *bun.DeleteQuery), hooks ModelHooks[ModelT]) error {
+	rType := reflect.TypeFor[*ModelT]()
+	if rType.Elem().Kind() != reflect.Struct {
+		return ErrModelNotStruct
+	}
 
-		//nolint
-		defer tx.Rollback()
-		commit = true
+	table := db.Dialect().Tables().Get(rType)
 
-	default:
-		return errors.New("unknown type: %s")
+	deletedField := softDeleteField(table)
+	if deletedField != nil && queryFn != nil {
+		return ErrSoftDeleteQuery
 	}
 
-	err = fn(ctx, tx)
+	hooks = withRegisteredHooks(hooks)
+
+	err := requireTenant(ctx, table)
 	if err != nil {
 		return err
 	}
 
-	if commit {
-		err = tx.Commit()
-		if err != nil {
-			return errs.Wrap(err, "committing transaction")
-		}
-	}
+	err = Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		// Another tenant's row is neither deleted nor reported as deleted. With
+		// queryFn, model need not identify the deleted rows, so only its
+		// related models are left alone.
+		owned := true
+		if tenantField(table) != nil {
+			var err error
+			owned, err = ownedByTenant(ctx, tx, table, model)
+			if err != nil {
+				return err
+			}
 
-	return nil
-}
+			if !owned && queryFn == nil {
+				return ErrNotFound
+			}
+		}
 
-/*delete false means update*/
-func relatedModels[ModelT any](ctx context.Context, bun bun.IDB, model *ModelT, delete bool) error {
-	modelType := reflect.TypeFor[ModelT]()
+		event := &hook.Event[ModelT]{Operation: hook.OperationDelete, Model: model}
+		queueAfters(ctx, hooks.AfterDelete, hooks.AfterEvent, event)
 
-	if modelType.Kind() != reflect.Struct {
-		return ErrModelNotStruct
-	}
+		for _, fn := range hooks.BeforeDelete {
+			err := fn(ctx, tx, model)
+			if err != nil {
+				return errs.Wrap(err, "before delete hook")
+			}
+		}
 
-	table := bun.NewSelect().Model(model).DB().Table(modelType)
+		if isAudited(table) || hooks.hasEvents() {
+			prev, err := loadPrevious(ctx, tx, table, table.PKs, model)
+			if err != nil {
+				return err
+			}
 
-	for _, relation := range table.Relations {
-		idx := relation.Field.StructField.Index
-		tag := modelType.FieldByIndex(idx).Tag
+			event.Previous = prev
+		}
 
-		tags, err := structtag.Parse(string(tag))
+		err := runBeforeEvents(ctx, tx, hooks.BeforeEvent, event, nil)
 		if err != nil {
-			return errs.Wrap(err, "parsing tags")
+			return err
 		}
 
-		baoTag, err := tags.Get("bao")
-		if err != nil {
-			continue
+		if isAudited(table) && event.Previous != nil {
+			err = audit(ctx, tx, table, auditOperationDelete, event.Previous, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Soft deleted models keep their related models.
+		if deletedField != nil {
+			return softDelete(ctx, tx, table, deletedField, model)
 		}
 
-		if !baoTag.HasOption("persist") {
-			continue
+		// Related models are deleted first so that their foreign keys never
+		// point at a deleted row.
+		if owned {
+			err = relatedModels(ctx, tx, model, true /*delete*/)
+			if err != nil {
+				return errs.Wrap(err, "deleting related models")
+			}
 		}
 
-		deleteModel := reflect.New(relation.JoinTable.Type)
-		q := bun.NewDelete().Model(deleteModel.Interface())
+		query := tx.NewDelete().Model(model)
 
-		for _, joinField := range relation.JoinPKs {
-			baseField := relation.BasePKs[0]
-			q.Where(fmt.Sprintf("%s = ?", string(joinField.SQLName)), baseField.Value(reflect.ValueOf(*model)).Interface())
+		if queryFn != nil {
+			queryFn(query)
+		} else {
+			query.WherePK()
 		}
 
-		_, err = q.Exec(ctx)
+		err = whereTenant(ctx, query, table)
 		if err != nil {
-			return errs.Wrapf(err, "deleting related model (%s)", relation.JoinTable.ModelName)
+			return err
 		}
 
-		if delete {
-			return nil
+		_, err = query.Exec(ctx)
+		if err != nil {
+			return errs.Wrap(err, "deleting model")
 		}
 
-		rInsertModel := relation.Field.Value(reflect.ValueOf(*model))
-		// Continue if there is nothing to insert.
-		if rInsertModel.IsZero() {
-			continue
-		}
+		return nil
+	})
+	if err != nil {
+		return asConstraintError(err)
+	}
+
+	return nil
+}
+
+// queueAfters runs afters and then afterEvents for the models of events once
+// the transaction of ctx has been committed. They get ctx, detached from the
+// committed transaction.
+func queueAfters[ModelT any](ctx context.Context, afters []hook.After[ModelT], afterEvents []hook.AfterEvent[ModelT], events ...*hook.Event[ModelT]) {
+	if len(afters) == 0 && len(afterEvents) == 0 {
+		return
+	}
+
+	// Without the transaction state, AfterCommit in a hook runs immediately
+	// instead of queueing onto a transaction that is already gone.
+	hookCtx := context.WithValue(ctx, trxStateKey{}, nil)
 
-		insertModel := rInsertModel.Interface()
+	AfterCommit(ctx, func(context.Context) {
+		for _, event := range events {
+			for _, fn := range afters {
+				fn(hookCtx, event.Model)
+			}
 
-		if rInsertModel.Kind() != reflect.Pointer {
-			rInsertModelPtr := reflect.New(rInsertModel.Type())
-			rInsertModelPtr.Elem().Set(rInsertModel)
-			insertModel = rInsertModelPtr.Interface()
+			for _, fn := range afterEvents {
+				fn(hookCtx, event)
+			}
 		}
+	})
+}
 
-		_, err = bun.NewInsert().Model(insertModel).Exec(ctx)
-		if err != nil {
-			return errs.Wrapf(err, "inserting related model (%s)", relation.JoinTable.ModelName)
+func fieldsByName(table *schema.Table, names []string) ([]*schema.Field, error) {
+	fields := make([]*schema.Field, 0, len(names))
+
+	for _, name := range names {
+		field, ok := table.FieldMap[name]
+		if !ok {
+			return nil, errs.Wrapf(ErrUnknownColumn, "column %s", name)
 		}
+
+		fields = append(fields, field)
 	}
 
-	return nil
+	return fields, nil
 }
 
-func validateID(s string) error {
-	_, err := uuid.Parse(s)
-	if err != nil {
-		return ErrIDNotUUID
+// IDValidator can be implemented by a model to validate the IDs passed to
+// FindByID and FindByIDForUpdate itself.
+type IDValidator interface {
+	ValidateID(id any) error
+}
+
+// validateID checks id before it is used to look up model by the primary key
+// column pk. In order:
+//   - the model's ValidateID method if it implements IDValidator,
+//   - the ID's Validate method if it has one,
+//   - string IDs of string and uuid columns must be UUIDs,
+//   - otherwise the ID must be comparable to the column, see validateKeyPart.
+func validateID(model any, pk *schema.Field, id any) error {
+	if validator, ok := model.(IDValidator); ok {
+		return validator.ValidateID(id)
 	}
 
-	return nil
+	if validator, ok := id.(interface{ Validate() error }); ok {
+		return validator.Validate()
+	}
+
+	if s, ok := id.(string); ok && (pk.IndirectType.Kind() == reflect.String || isUUIDField(pk)) {
+		_, err := uuid.Parse(s)
+		if err != nil {
+			return ErrIDNotUUID
+		}
+
+		return nil
+	}
+
+	return validateKeyPart(pk, id)
 }
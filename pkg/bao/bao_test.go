@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"math"
 	"strings"
 	"testing"
 
@@ -28,7 +29,9 @@ func testDB(t *testing.T) *bun.DB {
 
 	db := bun.NewDB(sqldb, pgdialect.New())
 
-	err := db.ResetModel(context.Background(), db, (*testModel)(nil), (*testRelatedModel)(nil), (*testRelatedModelNonPointer)(nil))
+	db.RegisterModel((*testAggregateModelTag)(nil))
+
+	err := db.ResetModel(context.Background(), db, (*testModel)(nil), (*testRelatedModel)(nil), (*testRelatedModelNonPointer)(nil), (*testSoftDeleteModel)(nil), (*testVersionModel)(nil), (*testAuditModel)(nil), (*AuditLog)(nil), (*testAggregateModel)(nil), (*testChildModel)(nil), (*testTagModel)(nil), (*testAggregateModelTag)(nil), (*testReplaceModel)(nil), (*testGrandchildModel)(nil), (*testSoftDeleteParentModel)(nil), (*testSoftDeleteRestrictModel)(nil), (*testSoftDeleteChildModel)(nil), (*testNodeModel)(nil), (*testRestrictModel)(nil), (*testNullifyModel)(nil), (*testCompositeKeyModel)(nil), (*testIntIDModel)(nil), (*testTypedIDModel)(nil), (*testULIDModel)(nil), (*testPatchModel)(nil), (*testTimestampModel)(nil), (*testPointerTimestampModel)(nil), (*testTenantModel)(nil), (*testUpsertModel)(nil), (*testStringUUIDModel)(nil), (*testIntTenantModel)(nil))
 	assert.NoError(err)
 
 	return db
@@ -41,6 +44,52 @@ type testModel struct {
 	RelatedNonPointer testRelatedModelNonPointer `bun:"rel:has-one,join:id=test_model_id" bao:",persist"`
 }
 
+type testIntIDModel struct {
+	ID   int64 `bun:",pk,autoincrement"`
+	Name string
+}
+
+type testTypedID uuid.UUID
+
+type testTypedIDModel struct {
+	ID   uuid.UUID `bun:",pk,type:uuid"`
+	Name string
+}
+
+type testStringUUIDModel struct {
+	ID   string `bun:",pk,type:uuid"`
+	Name string
+}
+
+type testULIDModel struct {
+	ID   string `bun:",pk"`
+	Name string
+}
+
+var errTestInvalidULID = errors.New("invalid ULID")
+
+func (*testULIDModel) ValidateID(id any) error {
+	s, ok := id.(string)
+	if !ok || len(s) != 26 {
+		return errTestInvalidULID
+	}
+
+	return nil
+}
+
+type testPatchModel struct {
+	ID    string `bun:",pk"`
+	Name  string
+	Email string
+}
+
+type testUpsertModel struct {
+	ID       string `bun:",pk"`
+	Email    string `bun:",unique"`
+	Name     string
+	Children []*testChildModel `bun:"rel:has-many,join:id=test_aggregate_model_id" bao:",persist"`
+}
+
 type testRelatedModel struct {
 	ID          string `bun:",pk"`
 	TestModelID string
@@ -249,6 +298,79 @@ func TestFind_not_found(t *testing.T) {
 	assert.Len(model, 0)
 }
 
+func TestFindAndCount(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		_, err := db.NewInsert().Model(&testModel{ID: uuid.New().String(), Name: name}).Exec(context.Background())
+		assert.NoError(err)
+	}
+
+	model, count, err := FindAndCount[testModel](context.Background(), db, func(q *bun.SelectQuery) {
+		q.Where("name <> ?", "a").Order("name")
+	}, 2, 2)
+	assert.NoError(err)
+
+	assert.Equal(4, count)
+	assert.Len(model, 2)
+	assert.Equal("d", model[0].Name)
+	assert.Equal("e", model[1].Name)
+}
+
+func TestFindAndCount_join(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New().String()
+	err := Create(context.Background(), db, &testModel{
+		ID: id,
+		Related: &testRelatedModel{
+			ID:          uuid.New().String(),
+			TestModelID: id,
+		},
+	}, nil, nil)
+	assert.NoError(err)
+
+	_, err = db.NewInsert().Model(&testModel{ID: uuid.New().String()}).Exec(context.Background())
+	assert.NoError(err)
+
+	model, count, err := FindAndCount[testModel](context.Background(), db, func(q *bun.SelectQuery) {
+		q.Relation("Related").Where("related.id IS NOT NULL")
+	}, 10, 0)
+	assert.NoError(err)
+
+	assert.Equal(1, count)
+	assert.Len(model, 1)
+	assert.Equal(id, model[0].ID)
+}
+
+func TestFindAndCount_in_transaction(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		for range 3 {
+			_, err := tx.NewInsert().Model(&testModel{ID: uuid.New().String()}).Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Rows inserted by the transaction are only visible to it, so the
+		// count must run on the transaction too.
+		model, count, err := FindAndCount[testModel](ctx, tx, nil, 1, 0)
+		assert.Len(model, 1)
+		assert.Equal(3, count)
+
+		return err
+	})
+	assert.NoError(err)
+}
+
 func TestFindFirst_query(t *testing.T) {
 	assert := assert.New(t)
 
@@ -284,6 +406,7 @@ func TestFindFirst_not_found(t *testing.T) {
 	model, err := FindFirst[testModel](context.Background(), db, nil)
 	assert.Nil(model)
 	assert.ErrorIs(err, sql.ErrNoRows)
+	assert.ErrorIs(err, ErrNotFound)
 }
 
 func TestFindByID(t *testing.T) {
@@ -335,6 +458,7 @@ func TestFindByID_not_found(t *testing.T) {
 	model, err := FindByID[testModel](context.Background(), db, "d69aba60-1d01-4f11-a1c5-64fa2d526050", nil)
 	assert.Nil(model)
 	assert.ErrorIs(err, sql.ErrNoRows)
+	assert.ErrorIs(err, ErrNotFound)
 }
 
 func TestFindByID_invalid_uuid(t *testing.T) {
@@ -347,6 +471,105 @@ func TestFindByID_invalid_uuid(t *testing.T) {
 	assert.ErrorIs(err, ErrIDNotUUID)
 }
 
+func TestFindByID_int(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testIntIDModel{
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+	assert.NotZero(insertModel.ID)
+
+	model, err := FindByID[testIntIDModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	model, err = FindByID[testIntIDModel](context.Background(), db, int32(insertModel.ID), nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	model, err = FindByID[testIntIDModel](context.Background(), db, "1", nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, ErrInvalidKey)
+
+	// Converting would wrap around to another ID.
+	model, err = FindByID[testIntIDModel](context.Background(), db, uint64(math.MaxUint64), nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, ErrInvalidKey)
+}
+
+func TestFindByID_typed_id(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testTypedIDModel{
+		ID:   uuid.New(),
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testTypedIDModel](context.Background(), db, testTypedID(insertModel.ID), nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	model, err = FindByID[testTypedIDModel](context.Background(), db, insertModel.ID.String(), nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	model, err = FindByID[testTypedIDModel](context.Background(), db, "invalid-id", nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, ErrIDNotUUID)
+}
+
+func TestFindByID_typed_id_string_column(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New()
+
+	insertModel := &testStringUUIDModel{
+		ID:   id.String(),
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testStringUUIDModel](context.Background(), db, testTypedID(id), nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	model, err = FindByKey[testStringUUIDModel](context.Background(), db, id, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+}
+
+func TestFindByID_model_validator(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testULIDModel{
+		ID:   "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		Name: "foo",
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testULIDModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	model, err = FindByID[testULIDModel](context.Background(), db, "invalid-id", nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, errTestInvalidULID)
+}
+
 func TestFindByIDForUpdate(t *testing.T) {
 	assert := assert.New(t)
 
@@ -471,6 +694,7 @@ func TestCreate_exists(t *testing.T) {
 	pgErr := &pgdriver.Error{}
 	assert.ErrorAs(err, pgErr)
 	assert.True(pgErr.IntegrityViolation())
+	assert.ErrorIs(err, ErrUniqueViolation)
 }
 
 func TestCreate_WithBeforeHooks_WithAfterHooks(t *testing.T) {
@@ -625,6 +849,293 @@ func TestUpdate_WithBeforeHooks_error(t *testing.T) {
 	assert.ErrorIs(err, beforeUpdateErr)
 }
 
+func TestUpdateColumns(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testPatchModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	first, err := FindByID[testPatchModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+
+	second, err := FindByID[testPatchModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+
+	first.Name = "foo"
+	err = UpdateColumns(context.Background(), db, first, []string{"name"}, nil, nil)
+	assert.NoError(err)
+
+	second.Email = "foo@example.com"
+	err = UpdateColumns(context.Background(), db, second, []string{"email"}, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testPatchModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+	assert.Equal("foo@example.com", model.Email)
+}
+
+func TestUpdateColumns_related(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New().String()
+
+	insertModel := &testModel{
+		ID: id,
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	insertModel.Related = &testRelatedModel{
+		ID:          uuid.New().String(),
+		TestModelID: id,
+	}
+
+	err = UpdateColumns(context.Background(), db, insertModel, []string{}, nil, nil)
+	assert.NoError(err)
+
+	model := &testModel{}
+	err = db.NewSelect().Model(model).Relation("Related").Scan(context.Background())
+	assert.NoError(err)
+	assert.Equal(insertModel.Related, model.Related)
+}
+
+func TestUpdateColumns_unknown_column(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testPatchModel{
+		ID: uuid.New().String(),
+	}
+
+	err := UpdateColumns(context.Background(), db, insertModel, []string{"unknown"}, nil, nil)
+	assert.ErrorIs(err, ErrUnknownColumn)
+}
+
+func TestUpdateColumns_WithBeforeHooks_WithAfterHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var beforeUpdateCalled bool
+	beforeUpdate := func(ctx context.Context, db bun.IDB, model *testPatchModel) error {
+		beforeUpdateCalled = true
+		model.Email = "foo@example.com"
+		return nil
+	}
+
+	var afterUpdateCalled bool
+	afterUpdate := func(ctx context.Context, model *testPatchModel) {
+		afterUpdateCalled = true
+	}
+
+	insertModel := &testPatchModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	insertModel.Name = "foo"
+	err = UpdateColumns(context.Background(), db, insertModel, []string{"name"}, []hook.Before[testPatchModel]{beforeUpdate}, []hook.After[testPatchModel]{afterUpdate})
+	assert.NoError(err)
+	assert.True(beforeUpdateCalled)
+	assert.True(afterUpdateCalled)
+
+	// Columns set by hooks are only written if they are in the column list.
+	model, err := FindByID[testPatchModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+	assert.Empty(model.Email)
+}
+
+func TestUpsert_insert(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New().String()
+
+	insertModel := &testModel{
+		ID:   id,
+		Name: "foo",
+		Related: &testRelatedModel{
+			ID:          uuid.New().String(),
+			TestModelID: id,
+		},
+	}
+
+	err := Upsert(context.Background(), db, insertModel, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	model := &testModel{}
+	err = db.NewSelect().Model(model).Relation("Related").Scan(context.Background())
+	assert.NoError(err)
+
+	assert.Equal(insertModel, model)
+}
+
+func TestUpsert_update(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	insertModel := &testModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	_, err := db.NewInsert().Model(insertModel).Exec(context.Background())
+	assert.NoError(err)
+
+	insertModel.Name = "bar"
+
+	err = Upsert(context.Background(), db, insertModel, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	model := &testModel{}
+	err = db.NewSelect().Model(model).Scan(context.Background())
+	assert.NoError(err)
+
+	assert.Equal(insertModel, model)
+
+	var upsertQuery string
+	for _, q := range qLogger.queries {
+		if strings.HasPrefix(q, "INSERT INTO \"test_models\"") {
+			upsertQuery = q
+		}
+	}
+
+	assert.Contains(upsertQuery, `ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)
+}
+
+func TestUpsert_update_columns(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	_, err := db.NewInsert().Model(insertModel).Exec(context.Background())
+	assert.NoError(err)
+
+	err = Upsert(context.Background(), db, &testModel{ID: insertModel.ID, Name: "bar"}, []string{"id"}, []string{}, nil, nil)
+	assert.NoError(err)
+
+	model := &testModel{}
+	err = db.NewSelect().Model(model).Scan(context.Background())
+	assert.NoError(err)
+
+	assert.Equal("foo", model.Name)
+}
+
+func TestUpsert_conflict_columns(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testUpsertModel{
+		ID:       uuid.New().String(),
+		Email:    "foo@example.com",
+		Name:     "foo",
+		Children: []*testChildModel{{ID: uuid.New().String(), Name: "a"}},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	upsertModel := &testUpsertModel{
+		ID:       uuid.New().String(),
+		Email:    "foo@example.com",
+		Name:     "bar",
+		Children: []*testChildModel{insertModel.Children[0], {ID: uuid.New().String(), Name: "b"}},
+	}
+	err = Upsert(context.Background(), db, upsertModel, []string{"email"}, nil, nil, nil)
+	assert.NoError(err)
+
+	// The existing row keeps its primary key, which is read back into the model.
+	assert.Equal(insertModel.ID, upsertModel.ID)
+	assert.Equal(insertModel.ID, upsertModel.Children[1].TestAggregateModelID)
+
+	model := &testUpsertModel{}
+	err = db.NewSelect().Model(model).Where("email = ?", "foo@example.com").Relation("Children").Scan(context.Background())
+	assert.NoError(err)
+	assert.Equal(insertModel.ID, model.ID)
+	assert.Equal("bar", model.Name)
+	assert.Len(model.Children, 2)
+
+	count, err := db.NewSelect().Model((*testUpsertModel)(nil)).Count(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, count)
+}
+
+func TestUpsert_unknown_column(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	err := Upsert(context.Background(), db, &testModel{ID: uuid.New().String()}, []string{"foo"}, nil, nil, nil)
+	assert.ErrorIs(err, ErrUnknownColumn)
+
+	err = Upsert(context.Background(), db, &testModel{ID: uuid.New().String()}, nil, []string{"foo"}, nil, nil)
+	assert.ErrorIs(err, ErrUnknownColumn)
+}
+
+func TestUpsert_WithBeforeHooks_WithAfterHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var beforeUpsertCalled bool
+	beforeUpsert := func(ctx context.Context, db bun.IDB, model *testModel) error {
+		beforeUpsertCalled = true
+		return nil
+	}
+
+	var afterUpsertCalled bool
+	afterUpsert := func(ctx context.Context, model *testModel) {
+		afterUpsertCalled = true
+	}
+
+	insertModel := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	err := Upsert(context.Background(), db, insertModel, nil, nil, []hook.Before[testModel]{beforeUpsert}, []hook.After[testModel]{afterUpsert})
+	assert.NoError(err)
+
+	assert.True(beforeUpsertCalled)
+	assert.True(afterUpsertCalled)
+}
+
+func TestUpsert_WithBeforeHooks_error(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	beforeUpsertErr := errors.New("test")
+	beforeUpsert := func(ctx context.Context, db bun.IDB, model *testModel) error {
+		return beforeUpsertErr
+	}
+
+	err := Upsert(context.Background(), db, &testModel{ID: uuid.New().String()}, nil, nil, []hook.Before[testModel]{beforeUpsert}, nil)
+	assert.ErrorIs(err, beforeUpsertErr)
+
+	exists, err := db.NewSelect().Model((*testModel)(nil)).Exists(context.Background())
+	assert.NoError(err)
+	assert.False(exists)
+}
+
 func TestDelete(t *testing.T) {
 	assert := assert.New(t)
 
@@ -887,6 +1398,103 @@ func TestTrx_nested_transaction(t *testing.T) {
 	assert.Equal(1, commitCount)
 }
 
+func TestTrx_nested_transaction_savepoint(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	insertModel := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		return Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			_, err := tx.NewInsert().Model(insertModel).Exec(ctx)
+			return err
+		})
+	})
+	assert.NoError(err)
+
+	var savepointCount int
+	var releaseCount int
+	for _, q := range qLogger.queries {
+		if strings.HasPrefix(q, "SAVEPOINT") {
+			savepointCount++
+		}
+
+		if strings.HasPrefix(q, "RELEASE SAVEPOINT") {
+			releaseCount++
+		}
+	}
+
+	assert.Equal(1, savepointCount)
+	assert.Equal(1, releaseCount)
+
+	exists, err := db.NewSelect().Model((*testModel)(nil)).Where("id = ?", insertModel.ID).Exists(context.Background())
+	assert.NoError(err)
+	assert.True(exists)
+}
+
+func TestTrx_nested_transaction_rollback(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	outerModel := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	innerModel := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	innerErr := errors.New("test")
+
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		_, err := tx.NewInsert().Model(outerModel).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			_, err := tx.NewInsert().Model(innerModel).Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			return innerErr
+		})
+		assert.ErrorIs(err, innerErr)
+
+		// The outer transaction must still be usable after the inner one fails.
+		return Create(ctx, tx, &testModel{ID: uuid.New().String()}, nil, nil)
+	})
+	assert.NoError(err)
+
+	var rollbackCount int
+	for _, q := range qLogger.queries {
+		if strings.HasPrefix(q, "ROLLBACK TO SAVEPOINT") {
+			rollbackCount++
+		}
+	}
+
+	assert.Equal(1, rollbackCount)
+
+	exists, err := db.NewSelect().Model((*testModel)(nil)).Where("id = ?", outerModel.ID).Exists(context.Background())
+	assert.NoError(err)
+	assert.True(exists)
+
+	exists, err = db.NewSelect().Model((*testModel)(nil)).Where("id = ?", innerModel.ID).Exists(context.Background())
+	assert.NoError(err)
+	assert.False(exists)
+}
+
 type queryLogger struct {
 	queries []string
 }
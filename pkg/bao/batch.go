@@ -0,0 +1,465 @@
+package bao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// ModelError is returned by the batch operations to report which model of the
+// batch failed. Index is the position of the model in the slice passed in.
+type ModelError struct {
+	Index int
+	Err   error
+}
+
+func (e *ModelError) Error() string {
+	return fmt.Sprintf("model %d: %s", e.Index, e.Err)
+}
+
+func (e *ModelError) Unwrap() error {
+	return e.Err
+}
+
+// CreateMany inserts models with a single multi-row INSERT inside a
+// transaction. befores run for every model before the INSERT and afters run
+// for every model once the transaction has been committed.
+func CreateMany[ModelT any](ctx context.Context, db bun.IDB, models []*ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	rType := reflect.TypeFor[*ModelT]()
+	if rType.Elem().Kind() != reflect.Struct {
+		return ErrModelNotStruct
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	table := db.Dialect().Tables().Get(rType)
+
+	hooks := withRegisteredHooks(ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters})
+
+	for i, model := range models {
+		err := setTenant(ctx, table, reflect.ValueOf(model).Elem())
+		if err != nil {
+			return &ModelError{Index: i, Err: err}
+		}
+	}
+
+	err := Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		events := newEvents(hook.OperationCreate, models)
+		queueAfters(ctx, hooks.AfterSave, hooks.AfterEvent, events...)
+
+		err := runBatchBefores(ctx, tx, models, hooks.BeforeSave, "before save hook")
+		if err != nil {
+			return err
+		}
+
+		err = runBatchBeforeEvents(ctx, tx, hooks.BeforeEvent, events, table.Fields)
+		if err != nil {
+			return err
+		}
+
+		t := now(ctx)
+		for _, model := range models {
+			err = setCreatedTimestamps(table, reflect.ValueOf(model).Elem(), t)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = execBatch(ctx, tx, models, func(ctx context.Context, tx bun.IDB, models []*ModelT) error {
+			_, err := tx.NewInsert().Model(&models).Exec(ctx)
+			return err
+		})
+		if err != nil {
+			return errs.Wrap(err, "inserting models")
+		}
+
+		if isAudited(table) {
+			err = auditMany(ctx, tx, table, auditOperationCreate, nil, models)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, model := range models {
+			err := relatedModels(ctx, tx, model, false /* update*/)
+			if err != nil {
+				return &ModelError{Index: i, Err: errs.Wrap(err, "creating related models")}
+			}
+		}
+
+		finishEvents(hooks.AfterEvent, events, table.Fields)
+
+		return nil
+	})
+	if err != nil {
+		return asConstraintError(err)
+	}
+
+	return nil
+}
+
+// UpdateMany updates models by primary key with a single multi-row UPDATE
+// inside a transaction. Returns a ModelError wrapping ErrDuplicateModel for the
+// first model whose primary key repeats that of an earlier one,
+// ErrUpdateNotExists for the first model that does not exist, or ErrStaleModel
+// for the first model whose version column no longer matches.
+func UpdateMany[ModelT any](ctx context.Context, db bun.IDB, models []*ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	rType := reflect.TypeFor[*ModelT]()
+	if rType.Elem().Kind() != reflect.Struct {
+		return ErrModelNotStruct
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	table := db.Dialect().Tables().Get(rType)
+	verField := versionField(table)
+
+	// The bulk UPDATE would write one of the duplicates and the rows affected
+	// would no longer match the models.
+	keys := make(map[string]struct{}, len(models))
+	for i, model := range models {
+		key := pkKey(table, reflect.ValueOf(model).Elem())
+		if _, ok := keys[key]; ok {
+			return &ModelError{Index: i, Err: ErrDuplicateModel}
+		}
+
+		keys[key] = struct{}{}
+	}
+
+	hooks := withRegisteredHooks(ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters})
+
+	for i, model := range models {
+		err := setTenant(ctx, table, reflect.ValueOf(model).Elem())
+		if err != nil {
+			return &ModelError{Index: i, Err: err}
+		}
+	}
+
+	fields := updatableFields(table)
+	columns := bulkUpdateColumns(table)
+
+	err := Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		events := newEvents(hook.OperationUpdate, models)
+		queueAfters(ctx, hooks.AfterSave, hooks.AfterEvent, events...)
+
+		existing, err := existingKeys(ctx, tx, table, models)
+		if err != nil {
+			return err
+		}
+
+		for i, model := range models {
+			if _, ok := existing[pkKey(table, reflect.ValueOf(model).Elem())]; !ok {
+				return &ModelError{Index: i, Err: ErrUpdateNotExists}
+			}
+		}
+
+		var prevs []*ModelT
+		if isAudited(table) || hooks.hasEvents() {
+			prevs, err = loadPreviousMany(ctx, tx, table, models)
+			if err != nil {
+				return err
+			}
+
+			for i, event := range events {
+				event.Previous = prevs[i]
+			}
+		}
+
+		err = runBatchBefores(ctx, tx, models, hooks.BeforeSave, "before save hook")
+		if err != nil {
+			return err
+		}
+
+		err = runBatchBeforeEvents(ctx, tx, hooks.BeforeEvent, events, fields)
+		if err != nil {
+			return err
+		}
+
+		t := now(ctx)
+		for _, model := range models {
+			err = setUpdatedTimestamp(table, reflect.ValueOf(model).Elem(), t)
+			if err != nil {
+				return err
+			}
+		}
+
+		var oldVersions []any
+		if verField != nil {
+			for _, model := range models {
+				oldVersion, err := bumpVersion(ctx, verField, reflect.ValueOf(model).Elem())
+				if err != nil {
+					return err
+				}
+
+				oldVersions = append(oldVersions, oldVersion)
+			}
+		}
+
+		// A bulk UPDATE needs at least one column to set.
+		if len(columns) > 0 {
+			err = execBatch(ctx, tx, models, func(ctx context.Context, tx bun.IDB, models []*ModelT) error {
+				query := tx.NewUpdate().Model(&models).Column(columns...).Bulk()
+
+				err := whereTenant(ctx, query, table)
+				if err != nil {
+					return err
+				}
+
+				// _data holds the bumped versions.
+				if verField != nil {
+					query.Where(fmt.Sprintf("%s.%s = _data.%s - 1", table.SQLAlias, verField.SQLName, verField.SQLName))
+				}
+
+				res, err := query.Exec(ctx)
+				if err != nil {
+					return err
+				}
+
+				if verField != nil {
+					affected, err := res.RowsAffected()
+					if err != nil {
+						return errs.Wrap(err, "getting rows affected")
+					}
+
+					if int(affected) != len(models) {
+						return ErrStaleModel
+					}
+				}
+
+				return nil
+			})
+			if errors.Is(err, ErrStaleModel) {
+				i, err := staleModelIndex(ctx, tx, table, verField, models, oldVersions)
+				if err != nil {
+					return err
+				}
+
+				return &ModelError{Index: i, Err: ErrStaleModel}
+			}
+			if err != nil {
+				return errs.Wrap(err, "updating models")
+			}
+		}
+
+		if isAudited(table) {
+			err = auditMany(ctx, tx, table, auditOperationUpdate, prevs, models)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, model := range models {
+			err := relatedModels(ctx, tx, model, false /* update*/)
+			if err != nil {
+				return &ModelError{Index: i, Err: errs.Wrap(err, "updating related models")}
+			}
+		}
+
+		finishEvents(hooks.AfterEvent, events, fields)
+
+		return nil
+	})
+	if err != nil {
+		return asConstraintError(err)
+	}
+
+	return nil
+}
+
+// DeleteMany deletes models by primary key with a single DELETE inside a
+// transaction. For tenant-scoped models, returns a ModelError wrapping
+// ErrNotFound for the first model that does not belong to the tenant.
+func DeleteMany[ModelT any](ctx context.Context, db bun.IDB, models []*ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	rType := reflect.TypeFor[*ModelT]()
+	if rType.Elem().Kind() != reflect.Struct {
+		return ErrModelNotStruct
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	table := db.Dialect().Tables().Get(rType)
+	deletedField := softDeleteField(table)
+
+	hooks := withRegisteredHooks(ModelHooks[ModelT]{BeforeDelete: befores, AfterDelete: afters})
+
+	err := requireTenant(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	err = Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		// Another tenant's rows are neither deleted nor reported as deleted.
+		if tenantField(table) != nil {
+			owned, err := existingKeys(ctx, tx, table, models)
+			if err != nil {
+				return err
+			}
+
+			for i, model := range models {
+				if _, ok := owned[pkKey(table, reflect.ValueOf(model).Elem())]; !ok {
+					return &ModelError{Index: i, Err: ErrNotFound}
+				}
+			}
+		}
+
+		events := newEvents(hook.OperationDelete, models)
+		queueAfters(ctx, hooks.AfterDelete, hooks.AfterEvent, events...)
+
+		err := runBatchBefores(ctx, tx, models, hooks.BeforeDelete, "before delete hook")
+		if err != nil {
+			return err
+		}
+
+		var prevs []*ModelT
+		if isAudited(table) || hooks.hasEvents() {
+			prevs, err = loadPreviousMany(ctx, tx, table, models)
+			if err != nil {
+				return err
+			}
+
+			for i, event := range events {
+				event.Previous = prevs[i]
+			}
+		}
+
+		err = runBatchBeforeEvents(ctx, tx, hooks.BeforeEvent, events, nil)
+		if err != nil {
+			return err
+		}
+
+		if isAudited(table) {
+			err = auditMany(ctx, tx, table, auditOperationDelete, prevs, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		if deletedField != nil {
+			return softDeleteMany(ctx, tx, table, deletedField, models)
+		}
+
+		for i, model := range models {
+			err := relatedModels(ctx, tx, model, true /*delete*/)
+			if err != nil {
+				return &ModelError{Index: i, Err: errs.Wrap(err, "deleting related models")}
+			}
+		}
+
+		err = execBatch(ctx, tx, models, func(ctx context.Context, tx bun.IDB, models []*ModelT) error {
+			query := tx.NewDelete().Model(&models).WherePK()
+
+			err := whereTenant(ctx, query, table)
+			if err != nil {
+				return err
+			}
+
+			_, err = query.Exec(ctx)
+			return err
+		})
+		if err != nil {
+			return errs.Wrap(err, "deleting models")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return asConstraintError(err)
+	}
+
+	return nil
+}
+
+func runBatchBefores[ModelT any](ctx context.Context, tx bun.IDB, models []*ModelT, befores []hook.Before[ModelT], msg string) error {
+	for i, model := range models {
+		for _, fn := range befores {
+			err := fn(ctx, tx, model)
+			if err != nil {
+				return &ModelError{Index: i, Err: errs.Wrap(err, msg)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// execBatch runs exec for all models as a single statement. A multi-row
+// statement does not tell which row it failed on, so when Postgres rejects it
+// the statement is re-run model by model, each in its own savepoint, to find
+// the offending model.
+func execBatch[ModelT any](ctx context.Context, tx bun.IDB, models []*ModelT, exec func(ctx context.Context, tx bun.IDB, models []*ModelT) error) error {
+	err := Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+		return exec(ctx, tx, models)
+	})
+	if err == nil {
+		return nil
+	}
+
+	// Only errors reported by Postgres can be pinned to a model. Serialization
+	// failures and deadlocks abort the transaction regardless.
+	if _, ok := asPgError(err); !ok || isRetryableTrxError(err) {
+		return err
+	}
+
+	for i, model := range models {
+		modelErr := Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			return exec(ctx, tx, []*ModelT{model})
+		})
+		if modelErr != nil {
+			return &ModelError{Index: i, Err: modelErr}
+		}
+	}
+
+	return err
+}
+
+// existingKeys returns the pkKey of each of models that exists and belongs to
+// the tenant of ctx.
+func existingKeys[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, models []*ModelT) (map[string]struct{}, error) {
+	pkNames := make([]string, 0, len(table.PKs))
+	for _, pk := range table.PKs {
+		pkNames = append(pkNames, pk.Name)
+	}
+
+	query := tx.NewSelect().Model(&models).Column(pkNames...).WherePK()
+
+	err := whereTenant(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []*ModelT
+	err = query.Scan(ctx, &existing)
+	if err != nil {
+		return nil, errs.Wrap(err, "checking if models exist")
+	}
+
+	keys := make(map[string]struct{}, len(existing))
+	for _, model := range existing {
+		keys[pkKey(table, reflect.ValueOf(model).Elem())] = struct{}{}
+	}
+
+	return keys, nil
+}
+
+// pkKey returns a string identifying the primary key of the struct strct.
+func pkKey(table *schema.Table, strct reflect.Value) string {
+	parts := make([]string, 0, len(table.PKs))
+	for _, pk := range table.PKs {
+		parts = append(parts, fmt.Sprint(pk.Value(strct).Interface()))
+	}
+
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,327 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+func TestCreateMany(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	id := uuid.New().String()
+
+	insertModels := []*testModel{
+		{
+			ID: id,
+			Related: &testRelatedModel{
+				ID:          uuid.New().String(),
+				TestModelID: id,
+			},
+		},
+		{
+			ID: uuid.New().String(),
+		},
+	}
+
+	err := CreateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	var insertCount int
+	for _, q := range qLogger.queries {
+		if strings.HasPrefix(q, `INSERT INTO "test_models"`) {
+			insertCount++
+		}
+	}
+
+	assert.Equal(1, insertCount)
+
+	var models []*testModel
+	err = db.NewSelect().Model(&models).Relation("Related").Order("test_model.id").Scan(context.Background())
+	assert.NoError(err)
+	assert.Len(models, 2)
+
+	model, err := FindByID[testModel](context.Background(), db, id, func(q *bun.SelectQuery) {
+		q.Relation("Related")
+	})
+	assert.NoError(err)
+	assert.Equal(insertModels[0], model)
+}
+
+func TestCreateMany_WithBeforeHooks_WithAfterHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var beforeCreateCount int
+	beforeCreate := func(ctx context.Context, db bun.IDB, model *testModel) error {
+		beforeCreateCount++
+		return nil
+	}
+
+	var afterCreateCount int
+	afterCreate := func(ctx context.Context, model *testModel) {
+		afterCreateCount++
+	}
+
+	insertModels := []*testModel{
+		{ID: uuid.New().String()},
+		{ID: uuid.New().String()},
+	}
+
+	err := CreateMany(context.Background(), db, insertModels, []hook.Before[testModel]{beforeCreate}, []hook.After[testModel]{afterCreate})
+	assert.NoError(err)
+
+	assert.Equal(2, beforeCreateCount)
+	assert.Equal(2, afterCreateCount)
+}
+
+func TestCreateMany_WithBeforeHooks_error(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	beforeCreateErr := errors.New("test")
+	failingID := uuid.New().String()
+	beforeCreate := func(ctx context.Context, db bun.IDB, model *testModel) error {
+		if model.ID == failingID {
+			return beforeCreateErr
+		}
+
+		return nil
+	}
+
+	insertModels := []*testModel{
+		{ID: uuid.New().String()},
+		{ID: failingID},
+	}
+
+	err := CreateMany(context.Background(), db, insertModels, []hook.Before[testModel]{beforeCreate}, nil)
+	assert.ErrorIs(err, beforeCreateErr)
+
+	modelErr := &ModelError{}
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(1, modelErr.Index)
+
+	exists, err := db.NewSelect().Model((*testModel)(nil)).Exists(context.Background())
+	assert.NoError(err)
+	assert.False(exists)
+}
+
+func TestCreateMany_exists(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	existingModel := &testModel{
+		ID: uuid.New().String(),
+	}
+	_, err := db.NewInsert().Model(existingModel).Exec(context.Background())
+	assert.NoError(err)
+
+	insertModels := []*testModel{
+		{ID: uuid.New().String()},
+		{ID: uuid.New().String()},
+		{ID: existingModel.ID},
+	}
+
+	err = CreateMany(context.Background(), db, insertModels, nil, nil)
+
+	modelErr := &ModelError{}
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(2, modelErr.Index)
+
+	pgErr := &pgdriver.Error{}
+	assert.ErrorAs(err, pgErr)
+	assert.True(pgErr.IntegrityViolation())
+
+	count, err := db.NewSelect().Model((*testModel)(nil)).Count(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, count)
+}
+
+func TestUpdateMany(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModels := []*testModel{
+		{ID: uuid.New().String(), Name: "foo"},
+		{ID: uuid.New().String(), Name: "bar"},
+	}
+	_, err := db.NewInsert().Model(&insertModels).Exec(context.Background())
+	assert.NoError(err)
+
+	insertModels[0].Name = "baz"
+	insertModels[1].Name = "qux"
+
+	err = UpdateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testModel](context.Background(), db, insertModels[0].ID, nil)
+	assert.NoError(err)
+	assert.Equal("baz", model.Name)
+
+	model, err = FindByID[testModel](context.Background(), db, insertModels[1].ID, nil)
+	assert.NoError(err)
+	assert.Equal("qux", model.Name)
+}
+
+func TestUpdateMany_not_exists(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	_, err := db.NewInsert().Model(insertModel).Exec(context.Background())
+	assert.NoError(err)
+
+	insertModel.Name = "bar"
+
+	err = UpdateMany(context.Background(), db, []*testModel{insertModel, {ID: uuid.New().String()}}, nil, nil)
+	assert.ErrorIs(err, ErrUpdateNotExists)
+
+	modelErr := &ModelError{}
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(1, modelErr.Index)
+
+	model, err := FindByID[testModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+}
+
+func TestUpdateMany_duplicate(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testModel{
+		ID:   uuid.New().String(),
+		Name: "foo",
+	}
+	_, err := db.NewInsert().Model(insertModel).Exec(context.Background())
+	assert.NoError(err)
+
+	err = UpdateMany(context.Background(), db, []*testModel{{ID: insertModel.ID, Name: "bar"}, {ID: insertModel.ID, Name: "baz"}}, nil, nil)
+	assert.ErrorIs(err, ErrDuplicateModel)
+
+	modelErr := &ModelError{}
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(1, modelErr.Index)
+
+	model, err := FindByID[testModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+}
+
+func TestUpdateMany_WithBeforeHooks_WithAfterHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var beforeUpdateCount int
+	beforeUpdate := func(ctx context.Context, db bun.IDB, model *testModel) error {
+		beforeUpdateCount++
+		return nil
+	}
+
+	var afterUpdateCount int
+	afterUpdate := func(ctx context.Context, model *testModel) {
+		afterUpdateCount++
+	}
+
+	insertModels := []*testModel{
+		{ID: uuid.New().String()},
+		{ID: uuid.New().String()},
+	}
+	_, err := db.NewInsert().Model(&insertModels).Exec(context.Background())
+	assert.NoError(err)
+
+	err = UpdateMany(context.Background(), db, insertModels, []hook.Before[testModel]{beforeUpdate}, []hook.After[testModel]{afterUpdate})
+	assert.NoError(err)
+
+	assert.Equal(2, beforeUpdateCount)
+	assert.Equal(2, afterUpdateCount)
+}
+
+func TestDeleteMany(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New().String()
+	relatedID := uuid.New().String()
+
+	insertModels := []*testModel{
+		{
+			ID: id,
+			Related: &testRelatedModel{
+				ID:          relatedID,
+				TestModelID: id,
+			},
+		},
+		{
+			ID: uuid.New().String(),
+		},
+	}
+	err := CreateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	keepModel := &testModel{
+		ID: uuid.New().String(),
+	}
+	_, err = db.NewInsert().Model(keepModel).Exec(context.Background())
+	assert.NoError(err)
+
+	err = DeleteMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	models, err := Find[testModel](context.Background(), db, nil)
+	assert.NoError(err)
+	assert.Len(models, 1)
+	assert.Equal(keepModel.ID, models[0].ID)
+
+	relatedModel := &testRelatedModel{}
+	err = db.NewSelect().Model(relatedModel).Where("id = ?", relatedID).Scan(context.Background())
+	assert.ErrorIs(err, sql.ErrNoRows)
+}
+
+func TestDeleteMany_WithBeforeHooks_error(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	beforeDeleteErr := errors.New("test")
+	beforeDelete := func(ctx context.Context, db bun.IDB, model *testModel) error {
+		return beforeDeleteErr
+	}
+
+	insertModels := []*testModel{
+		{ID: uuid.New().String()},
+	}
+	_, err := db.NewInsert().Model(&insertModels).Exec(context.Background())
+	assert.NoError(err)
+
+	err = DeleteMany(context.Background(), db, insertModels, []hook.Before[testModel]{beforeDelete}, nil)
+	assert.ErrorIs(err, beforeDeleteErr)
+
+	modelErr := &ModelError{}
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(0, modelErr.Index)
+}
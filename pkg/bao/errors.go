@@ -6,4 +6,24 @@ var ErrModelNotStructOrSlice = errors.New("model must be a struct or a slice")
 var ErrModelNotStruct = errors.New("model must be a pointer to a struct")
 var ErrOnePrimaryKey = errors.New("table must have exactly one primary key")
 var ErrUpdateNotExists = errors.New("model to be updated does not exist")
-var ErrIDNotUUID = errors.New("id must be a valid UUID")
\ No newline at end of file
+var ErrIDNotUUID = errors.New("id must be a valid UUID")
+var ErrUnknownColumn = errors.New("model does not have column")
+var ErrNoConflictColumns = errors.New("upsert requires conflict columns or a primary key")
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+var ErrInvalidLimit = errors.New("limit must be greater than zero")
+var ErrFieldNotTime = errors.New("field must be a time.Time, sql.NullTime or bun.NullTime, or a pointer to one")
+var ErrSoftDeleteQuery = errors.New("soft deletable models can only be deleted by primary key")
+var ErrFieldNotInteger = errors.New("field must be an integer")
+var ErrStaleModel = errors.New("model has been modified since it was read")
+var ErrDuplicateModel = errors.New("models must have distinct primary keys")
+var ErrRelationCycle = errors.New("persisted relations form a cycle")
+var ErrUnknownOnDelete = errors.New("ondelete must be cascade, restrict or nullify")
+var ErrRelatedModelsExist = errors.New("model cannot be deleted while related models exist")
+var ErrInvalidKey = errors.New("key does not match the primary key")
+var ErrNotFound = errors.New("model not found")
+var ErrUniqueViolation = errors.New("unique constraint violation")
+var ErrForeignKeyViolation = errors.New("foreign key constraint violation")
+var ErrCheckViolation = errors.New("check constraint violation")
+var ErrNoTenant = errors.New("model is scoped to a tenant but context has no tenant")
+var ErrInvalidTenant = errors.New("tenant does not match the tenant column")
+var ErrTenantMismatch = errors.New("model belongs to another tenant")
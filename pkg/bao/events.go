@@ -0,0 +1,88 @@
+package bao
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+func newEvents[ModelT any](operation hook.Operation, models []*ModelT) []*hook.Event[ModelT] {
+	events := make([]*hook.Event[ModelT], 0, len(models))
+	for _, model := range models {
+		events = append(events, &hook.Event[ModelT]{
+			Operation: operation,
+			Model:     model,
+		})
+	}
+
+	return events
+}
+
+// setChanged sets the changed columns of event to the columns of fields whose
+// value differs between the previous state and the model.
+func setChanged[ModelT any](event *hook.Event[ModelT], fields []*schema.Field) {
+	event.Changed = nil
+
+	if event.Operation == hook.OperationDelete {
+		return
+	}
+
+	strct := reflect.ValueOf(event.Model).Elem()
+
+	for _, field := range fields {
+		if event.Previous != nil {
+			prev := field.Value(reflect.ValueOf(event.Previous).Elem()).Interface()
+			if reflect.DeepEqual(prev, field.Value(strct).Interface()) {
+				continue
+			}
+		}
+
+		event.Changed = append(event.Changed, field.Name)
+	}
+}
+
+// runBeforeEvents runs befores for event once the columns of fields that are
+// about to change have been set on it.
+func runBeforeEvents[ModelT any](ctx context.Context, tx bun.IDB, befores []hook.BeforeEvent[ModelT], event *hook.Event[ModelT], fields []*schema.Field) error {
+	if len(befores) == 0 {
+		return nil
+	}
+
+	setChanged(event, fields)
+
+	for _, fn := range befores {
+		err := fn(ctx, tx, event)
+		if err != nil {
+			return errs.Wrap(err, "before event hook")
+		}
+	}
+
+	return nil
+}
+
+func runBatchBeforeEvents[ModelT any](ctx context.Context, tx bun.IDB, befores []hook.BeforeEvent[ModelT], events []*hook.Event[ModelT], fields []*schema.Field) error {
+	for i, event := range events {
+		err := runBeforeEvents(ctx, tx, befores, event, fields)
+		if err != nil {
+			return &ModelError{Index: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// finishEvents sets the columns of fields that were written with a new value
+// on events, for the after event hooks.
+func finishEvents[ModelT any](afters []hook.AfterEvent[ModelT], events []*hook.Event[ModelT], fields []*schema.Field) {
+	if len(afters) == 0 {
+		return
+	}
+
+	for _, event := range events {
+		setChanged(event, fields)
+	}
+}
@@ -0,0 +1,147 @@
+package bao
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+// testEvents registers event hooks for testPatchModel that record the events
+// they are called with.
+func testEvents(t *testing.T) (befores, afters *[]hook.Event[testPatchModel]) {
+	befores = &[]hook.Event[testPatchModel]{}
+	afters = &[]hook.Event[testPatchModel]{}
+
+	RegisterHooks(ModelHooks[testPatchModel]{
+		BeforeEvent: []hook.BeforeEvent[testPatchModel]{func(ctx context.Context, db bun.IDB, event *hook.Event[testPatchModel]) error {
+			*befores = append(*befores, *event)
+			return nil
+		}},
+		AfterEvent: []hook.AfterEvent[testPatchModel]{func(ctx context.Context, event *hook.Event[testPatchModel]) {
+			*afters = append(*afters, *event)
+		}},
+	})
+	t.Cleanup(unregisterHooks[testPatchModel])
+
+	return befores, afters
+}
+
+func TestEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	befores, afters := testEvents(t)
+
+	model := &testPatchModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+	assert.Len(*befores, 1)
+	assert.Equal(hook.OperationCreate, (*befores)[0].Operation)
+	assert.Equal(model, (*befores)[0].Model)
+	assert.Nil((*befores)[0].Previous)
+	assert.Equal([]string{"id", "name", "email"}, (*befores)[0].Changed)
+	assert.Equal((*befores)[0], (*afters)[0])
+
+	model.Name = "foo"
+	err = Update(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+	assert.Len(*afters, 2)
+	assert.Equal(hook.OperationUpdate, (*afters)[1].Operation)
+	assert.Equal("", (*afters)[1].Previous.Name)
+	assert.Equal([]string{"name"}, (*afters)[1].Changed)
+	assert.True((*afters)[1].HasChanged("name"))
+
+	// Only written columns are changed.
+	model.Name = "bar"
+	model.Email = "foo@example.com"
+	err = UpdateColumns(context.Background(), db, model, []string{"email"}, nil, nil)
+	assert.NoError(err)
+	assert.Len(*afters, 3)
+	assert.Equal([]string{"email"}, (*afters)[2].Changed)
+
+	err = Delete(context.Background(), db, model, nil, nil, nil)
+	assert.NoError(err)
+	assert.Len(*afters, 4)
+	assert.Equal(hook.OperationDelete, (*afters)[3].Operation)
+	assert.Equal("foo", (*afters)[3].Previous.Name)
+	assert.Empty((*afters)[3].Changed)
+}
+
+func TestEvents_upsert(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	_, afters := testEvents(t)
+
+	id := uuid.New().String()
+
+	err := Upsert(context.Background(), db, &testPatchModel{ID: id}, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	err = Upsert(context.Background(), db, &testPatchModel{ID: id, Name: "foo"}, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	assert.Len(*afters, 2)
+	assert.Equal(hook.OperationCreate, (*afters)[0].Operation)
+	assert.Equal(hook.OperationUpdate, (*afters)[1].Operation)
+	assert.Equal(id, (*afters)[1].Previous.ID)
+	assert.Equal([]string{"name"}, (*afters)[1].Changed)
+}
+
+func TestEvents_batch(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	_, afters := testEvents(t)
+
+	models := []*testPatchModel{{ID: uuid.New().String()}, {ID: uuid.New().String()}}
+	err := CreateMany(context.Background(), db, models, nil, nil)
+	assert.NoError(err)
+
+	models[1].Name = "foo"
+	err = UpdateMany(context.Background(), db, models, nil, nil)
+	assert.NoError(err)
+
+	err = DeleteMany(context.Background(), db, models, nil, nil)
+	assert.NoError(err)
+
+	assert.Len(*afters, 6)
+	assert.Equal(hook.OperationUpdate, (*afters)[2].Operation)
+	assert.Empty((*afters)[2].Changed)
+	assert.Equal([]string{"name"}, (*afters)[3].Changed)
+	assert.Equal(hook.OperationDelete, (*afters)[5].Operation)
+	assert.Equal("foo", (*afters)[5].Previous.Name)
+}
+
+func TestEvents_before_error(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	hookErr := errors.New("test")
+
+	var afterCalled bool
+	repo := NewRepository(db,
+		WithBeforeEventHooks(func(ctx context.Context, db bun.IDB, event *hook.Event[testPatchModel]) error {
+			return hookErr
+		}),
+		WithAfterEventHooks(func(ctx context.Context, event *hook.Event[testPatchModel]) {
+			afterCalled = true
+		}),
+	)
+
+	err := repo.Create(context.Background(), &testPatchModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, hookErr)
+	assert.False(afterCalled)
+
+	models, err := Find[testPatchModel](context.Background(), db, nil)
+	assert.NoError(err)
+	assert.Empty(models)
+}
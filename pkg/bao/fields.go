@@ -0,0 +1,71 @@
+package bao
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/fatih/structtag"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// fieldHasOption reports whether field has a bao tag with the given option,
+// e.g. bao:",softdelete".
+func fieldHasOption(field *schema.Field, option string) bool {
+	tags, err := structtag.Parse(string(field.StructField.Tag))
+	if err != nil {
+		return false
+	}
+
+	baoTag, err := tags.Get("bao")
+	if err != nil {
+		return false
+	}
+
+	return baoTag.HasOption(option)
+}
+
+// taggedField returns the first column of table with the given bao tag option
+// or nil if there is none.
+func taggedField(table *schema.Table, option string) *schema.Field {
+	for _, field := range table.Fields {
+		if fieldHasOption(field, option) {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// setTimeField sets field of strct to t. The field must be a time.Time,
+// sql.NullTime or bun.NullTime, or a pointer to one.
+func setTimeField(field *schema.Field, strct reflect.Value, t time.Time) error {
+	var value any
+
+	switch field.IndirectType {
+	case reflect.TypeFor[time.Time]():
+		value = t
+
+	case reflect.TypeFor[sql.NullTime]():
+		value = sql.NullTime{Time: t, Valid: true}
+
+	case reflect.TypeFor[bun.NullTime]():
+		value = bun.NullTime{Time: t}
+
+	default:
+		return errs.Wrapf(ErrFieldNotTime, "column %s", field.Name)
+	}
+
+	rValue := reflect.ValueOf(value)
+	if field.IsPtr {
+		ptr := reflect.New(rValue.Type())
+		ptr.Elem().Set(rValue)
+		rValue = ptr
+	}
+
+	field.Value(strct).Set(rValue)
+
+	return nil
+}
@@ -2,9 +2,45 @@ package hook
 
 import (
 	"context"
+	"slices"
 
 	"github.com/uptrace/bun"
 )
 
 type Before[ModelT any] func(ctx context.Context, db bun.IDB, model *ModelT) error
 type After[ModelT any] func(ctx context.Context, model *ModelT)
+
+// BeforeFind is called before a find query runs, inside the transaction the
+// query runs in. It may add to the query.
+type BeforeFind[ModelT any] func(ctx context.Context, db bun.IDB, query *bun.SelectQuery) error
+
+// AfterFind is called with the models loaded by a find query.
+type AfterFind[ModelT any] func(ctx context.Context, models []*ModelT) error
+
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+)
+
+// Event describes the write of a model.
+type Event[ModelT any] struct {
+	Operation Operation
+	Model     *ModelT
+	// Previous is the persisted state of the model before an update or a
+	// delete. It is nil on create.
+	Previous *ModelT
+	// Changed holds the columns written with a value that differs from
+	// Previous. Every written column is changed on create and none on delete.
+	Changed []string
+}
+
+// HasChanged reports whether column is one of the changed columns.
+func (e *Event[ModelT]) HasChanged(column string) bool {
+	return slices.Contains(e.Changed, column)
+}
+
+type BeforeEvent[ModelT any] func(ctx context.Context, db bun.IDB, event *Event[ModelT]) error
+type AfterEvent[ModelT any] func(ctx context.Context, event *Event[ModelT])
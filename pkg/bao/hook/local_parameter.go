@@ -2,34 +2,93 @@ package hook
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/eleanorhealth/go-common/pkg/errs"
 	"github.com/uptrace/bun"
 )
 
+var ErrInvalidLocalParameter = errors.New("invalid local parameter name")
+
+// localParameterName matches Postgres parameter names, e.g. statement_timeout
+// or myapp.user_id.
+var localParameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*$`)
+
 func LocalParameterBeforeHook[ModelT any](fn func(ctx context.Context) map[string]string) Before[ModelT] {
 	return func(ctx context.Context, db bun.IDB, model *ModelT) error {
-		var vars map[string]string
+		return setLocalParametersFn(ctx, db, fn)
+	}
+}
 
-		if fn != nil {
-			vars = fn(ctx)
-		}
+// LocalParameterBeforeFindHook is LocalParameterBeforeHook for find queries,
+// e.g. to set the parameters a row level security policy reads.
+func LocalParameterBeforeFindHook[ModelT any](fn func(ctx context.Context) map[string]string) BeforeFind[ModelT] {
+	return func(ctx context.Context, db bun.IDB, query *bun.SelectQuery) error {
+		return setLocalParametersFn(ctx, db, fn)
+	}
+}
 
-		var builder strings.Builder
-		var args []any
+func setLocalParametersFn(ctx context.Context, db bun.IDB, fn func(ctx context.Context) map[string]string) error {
+	if fn == nil {
+		return nil
+	}
 
-		for k, v := range vars {
-			fmt.Fprintf(&builder, `SET LOCAL "%s" = ?;`, k)
-			args = append(args, v)
-		}
+	return SetLocalParameters(ctx, db, fn(ctx))
+}
+
+// SetLocalParameters runs SET LOCAL for each of params, in the order of their
+// names. The parameters last until the end of the transaction db belongs to,
+// or are lost immediately if db is not a transaction. Returns
+// ErrInvalidLocalParameter, without setting any parameter, if a name is not a
+// valid parameter name.
+func SetLocalParameters(ctx context.Context, db bun.IDB, params map[string]string) error {
+	if len(params) == 0 {
+		return nil
+	}
 
-		_, err := db.ExecContext(ctx, builder.String(), args...)
-		if err != nil {
-			return errs.Wrapf(err, "setting local parameters")
+	names := slices.Sorted(maps.Keys(params))
+
+	var builder strings.Builder
+	args := make([]any, 0, len(names))
+
+	for _, name := range names {
+		if !localParameterName.MatchString(name) {
+			return errs.Wrapf(ErrInvalidLocalParameter, "%q", name)
 		}
 
-		return nil
+		fmt.Fprintf(&builder, `SET LOCAL "%s" = ?;`, name)
+		args = append(args, params[name])
+	}
+
+	_, err := db.ExecContext(ctx, builder.String(), args...)
+	if err != nil {
+		return errs.Wrapf(err, "setting local parameters")
+	}
+
+	return nil
+}
+
+// LocalParameter returns the current value of the parameter name, or an empty
+// string if it has not been set.
+func LocalParameter(ctx context.Context, db bun.IDB, name string) (string, error) {
+	if !localParameterName.MatchString(name) {
+		return "", errs.Wrapf(ErrInvalidLocalParameter, "%q", name)
+	}
+
+	var value *string
+	err := db.NewSelect().ColumnExpr("current_setting(?, true)", name).Scan(ctx, &value)
+	if err != nil {
+		return "", errs.Wrapf(err, "reading local parameter")
 	}
+
+	if value == nil {
+		return "", nil
+	}
+
+	return *value, nil
 }
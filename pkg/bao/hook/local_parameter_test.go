@@ -25,7 +25,99 @@ func TestLocalParameterBeforeHook(t *testing.T) {
 	err := hook(context.Background(), db, &testModel{})
 	assert.NoError(err)
 
+	assert.Len(qLogger.queries, 1)
+	assert.Equal(`SET LOCAL "myapp.bar" = 'baz';SET LOCAL "myapp.foo" = 'bar';`, qLogger.queries[0])
+}
+
+func TestLocalParameterBeforeHook_empty(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	hook := LocalParameterBeforeHook[testModel](func(ctx context.Context) map[string]string {
+		return nil
+	})
+
+	err := hook(context.Background(), db, &testModel{})
+	assert.NoError(err)
+
+	err = LocalParameterBeforeHook[testModel](nil)(context.Background(), db, &testModel{})
+	assert.NoError(err)
+
+	assert.Empty(qLogger.queries)
+}
+
+func TestLocalParameterBeforeHook_invalid_name(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	for _, name := range []string{"", "myapp.", ".foo", "1myapp.foo", `myapp.foo"; RESET ALL; --`, "myapp foo"} {
+		hook := LocalParameterBeforeHook[testModel](func(ctx context.Context) map[string]string {
+			return map[string]string{
+				"myapp.foo": "bar",
+				name:        "baz",
+			}
+		})
+
+		err := hook(context.Background(), db, &testModel{})
+		assert.ErrorIs(err, ErrInvalidLocalParameter, name)
+	}
+
+	assert.Empty(qLogger.queries)
+}
+
+func TestSetLocalParameters(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	assert.NoError(err)
+	defer tx.Rollback() //nolint
+
+	err = SetLocalParameters(context.Background(), tx, map[string]string{
+		"myapp.user_id": "user-1",
+		"myapp.quote":   "it's",
+	})
+	assert.NoError(err)
+
+	value, err := LocalParameter(context.Background(), tx, "myapp.user_id")
+	assert.NoError(err)
+	assert.Equal("user-1", value)
+
+	value, err = LocalParameter(context.Background(), tx, "myapp.quote")
+	assert.NoError(err)
+	assert.Equal("it's", value)
+
+	value, err = LocalParameter(context.Background(), tx, "myapp.unset")
+	assert.NoError(err)
+	assert.Empty(value)
+}
+
+func TestLocalParameterBeforeFindHook(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	qLogger := &queryLogger{}
+	db.AddQueryHook(qLogger)
+
+	hook := LocalParameterBeforeFindHook[testModel](func(ctx context.Context) map[string]string {
+		return map[string]string{
+			"myapp.foo": "bar",
+		}
+	})
+
+	err := hook(context.Background(), db, db.NewSelect().Model(&testModel{}))
+	assert.NoError(err)
+
 	assert.Len(qLogger.queries, 1)
 	assert.Contains(qLogger.queries[0], `SET LOCAL "myapp.foo" = 'bar'`)
-	assert.Contains(qLogger.queries[0], `SET LOCAL "myapp.bar" = 'baz'`)
 }
@@ -0,0 +1,218 @@
+package bao
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/fatih/structtag"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// whereKey restricts query to the row of table whose primary key is key.
+func whereKey(query *bun.SelectQuery, table *schema.Table, key any) error {
+	values, err := keyValues(table, key)
+	if err != nil {
+		return err
+	}
+
+	for i, pk := range table.PKs {
+		query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, pk.SQLName), keyArg(pk, values[i]))
+	}
+
+	return nil
+}
+
+// keyValues returns the values of key ordered like the primary key columns of
+// table. key is either a []any ordered like the primary key columns, a struct
+// with a field for each primary key column, matched by Go name or bun column
+// name, or, for tables with a single primary key column, the value itself.
+func keyValues(table *schema.Table, key any) ([]any, error) {
+	if len(table.PKs) == 0 {
+		return nil, errs.Wrapf(ErrInvalidKey, "%s has no primary key", table.ModelName)
+	}
+
+	var values []any
+
+	rKey := reflect.Indirect(reflect.ValueOf(key))
+
+	switch {
+	case rKey.Kind() == reflect.Slice && rKey.Type().Elem().Kind() == reflect.Interface:
+		for i := range rKey.Len() {
+			values = append(values, rKey.Index(i).Interface())
+		}
+
+	case rKey.Kind() == reflect.Struct && !(len(table.PKs) == 1 && rKey.Type().AssignableTo(table.PKs[0].IndirectType)):
+		var err error
+		values, err = keyStructValues(table, rKey)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		values = []any{key}
+	}
+
+	if len(values) != len(table.PKs) {
+		return nil, errs.Wrapf(ErrInvalidKey, "got %d values for %d primary key columns", len(values), len(table.PKs))
+	}
+
+	for i, pk := range table.PKs {
+		err := validateKeyPart(pk, values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func keyStructValues(table *schema.Table, strct reflect.Value) ([]any, error) {
+	values := make([]any, 0, len(table.PKs))
+
+	for _, pk := range table.PKs {
+		field, ok := keyStructField(strct, pk)
+		if !ok {
+			return nil, errs.Wrapf(ErrInvalidKey, "key has no field for column %s", pk.Name)
+		}
+
+		values = append(values, field.Interface())
+	}
+
+	return values, nil
+}
+
+func keyStructField(strct reflect.Value, pk *schema.Field) (reflect.Value, bool) {
+	for i := range strct.NumField() {
+		sf := strct.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		if sf.Name == pk.GoName {
+			return strct.Field(i), true
+		}
+
+		tags, err := structtag.Parse(string(sf.Tag))
+		if err != nil {
+			continue
+		}
+
+		bunTag, err := tags.Get("bun")
+		if err == nil && bunTag.Name == pk.Name {
+			return strct.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+// validateKeyPart checks that value can be compared to the primary key column
+// pk: it must have the column's Go type, or be an integer for an integer
+// column, or a string for a string column. Strings must be valid UUIDs for
+// uuid columns.
+func validateKeyPart(pk *schema.Field, value any) error {
+	rValue := reflect.ValueOf(value)
+	if !rValue.IsValid() || (rValue.Kind() == reflect.Pointer && rValue.IsNil()) {
+		return errs.Wrapf(ErrInvalidKey, "column %s: value is nil", pk.Name)
+	}
+
+	rValue = reflect.Indirect(rValue)
+	vType := rValue.Type()
+	pkType := pk.IndirectType
+
+	isUUID := isUUIDField(pk)
+
+	switch {
+	case isUUID && rValue.Kind() == reflect.String:
+		_, err := uuid.Parse(rValue.String())
+		if err != nil {
+			return errs.Wrapf(ErrInvalidKey, "column %s: %s is not a valid UUID", pk.Name, rValue.String())
+		}
+
+		return nil
+
+	case vType.AssignableTo(pkType):
+		return nil
+
+	case isIntKind(vType.Kind()) && isIntKind(pkType.Kind()):
+		if !intFits(rValue, pkType) {
+			return errs.Wrapf(ErrInvalidKey, "column %s: %v is out of range for %s", pk.Name, rValue.Interface(), pkType)
+		}
+
+		return nil
+
+	case vType.Kind() == reflect.String && pkType.Kind() == reflect.String:
+		return nil
+
+	case isUUID && vType.ConvertibleTo(reflect.TypeFor[uuid.UUID]()):
+		return nil
+	}
+
+	return errs.Wrapf(ErrInvalidKey, "column %s: %s is not a %s", pk.Name, vType, pkType)
+}
+
+// keyArg converts a validated key part to the Go type of the primary key
+// column pk, so that e.g. ID types defined as uuid.UUID are passed to the
+// driver as uuid.UUID.
+func keyArg(pk *schema.Field, value any) any {
+	rValue := reflect.Indirect(reflect.ValueOf(value))
+
+	// bun writes typed UUIDs as bytea, which a string uuid column cannot be
+	// compared to.
+	uuidType := reflect.TypeFor[uuid.UUID]()
+	if isUUIDField(pk) && pk.IndirectType.Kind() == reflect.String && rValue.Kind() != reflect.String && rValue.Type().ConvertibleTo(uuidType) {
+		return rValue.Convert(uuidType).Interface().(uuid.UUID).String()
+	}
+
+	if rValue.Type() == pk.IndirectType || !rValue.Type().ConvertibleTo(pk.IndirectType) {
+		return value
+	}
+
+	// Only convert between the kinds validateKeyPart accepts.
+	if rValue.Kind() != pk.IndirectType.Kind() && !(isIntKind(rValue.Kind()) && isIntKind(pk.IndirectType.Kind())) {
+		return value
+	}
+
+	return rValue.Convert(pk.IndirectType).Interface()
+}
+
+func isUUIDField(field *schema.Field) bool {
+	return field.IndirectType == reflect.TypeFor[uuid.UUID]() || strings.EqualFold(field.UserSQLType, "uuid")
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// intFits reports whether the integer value can be converted to the integer
+// type t without overflowing.
+func intFits(value reflect.Value, t reflect.Type) bool {
+	target := reflect.New(t).Elem()
+
+	if value.CanInt() {
+		i := value.Int()
+		if target.CanUint() {
+			return i >= 0 && !target.OverflowUint(uint64(i))
+		}
+
+		return !target.OverflowInt(i)
+	}
+
+	u := value.Uint()
+	if target.CanInt() {
+		return u <= math.MaxInt64 && !target.OverflowInt(int64(u))
+	}
+
+	return !target.OverflowUint(u)
+}
@@ -0,0 +1,117 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCompositeKeyModel struct {
+	TenantID uuid.UUID `bun:",pk,type:uuid"`
+	Number   int64     `bun:"num,pk"`
+	Name     string
+}
+
+type testCompositeKey struct {
+	TenantID uuid.UUID
+	Num      int32 `bun:"num"`
+}
+
+func TestFindByKey_struct(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testCompositeKeyModel{
+		TenantID: uuid.New(),
+		Number:   1,
+		Name:     "foo",
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByKey[testCompositeKeyModel](context.Background(), db, testCompositeKey{
+		TenantID: insertModel.TenantID,
+		Num:      1,
+	}, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+}
+
+func TestFindByKey_values(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testCompositeKeyModel{
+		TenantID: uuid.New(),
+		Number:   1,
+		Name:     "foo",
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByKey[testCompositeKeyModel](context.Background(), db, []any{insertModel.TenantID.String(), 1}, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	_, err = FindByKey[testCompositeKeyModel](context.Background(), db, []any{insertModel.TenantID, 2}, nil)
+	assert.ErrorIs(err, sql.ErrNoRows)
+}
+
+func TestFindByKey_single(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByKey[testModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel.ID, model.ID)
+}
+
+func TestFindByKey_invalid_key(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, err := FindByKey[testCompositeKeyModel](context.Background(), db, []any{uuid.New()}, nil)
+	assert.ErrorIs(err, ErrInvalidKey)
+
+	_, err = FindByKey[testCompositeKeyModel](context.Background(), db, []any{"foo", 1}, nil)
+	assert.ErrorIs(err, ErrInvalidKey)
+
+	_, err = FindByKey[testCompositeKeyModel](context.Background(), db, []any{uuid.New(), "1"}, nil)
+	assert.ErrorIs(err, ErrInvalidKey)
+
+	_, err = FindByKey[testCompositeKeyModel](context.Background(), db, struct{ TenantID uuid.UUID }{uuid.New()}, nil)
+	assert.ErrorIs(err, ErrInvalidKey)
+}
+
+func TestFindByKeyForUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testCompositeKeyModel{
+		TenantID: uuid.New(),
+		Number:   1,
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByKeyForUpdate[testCompositeKeyModel](context.Background(), db, testCompositeKey{
+		TenantID: insertModel.TenantID,
+		Num:      1,
+	}, false, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+}
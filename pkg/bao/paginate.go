@@ -0,0 +1,200 @@
+package bao
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+type sortField struct {
+	field *schema.Field
+	desc  bool
+}
+
+// Paginate returns up to limit models ordered by sort, starting after the row
+// encoded in cursor (pass "" for the first page), together with the cursor of
+// the next page ("" on the last page).
+//
+// Pagination is keyset based: the cursor holds the sort key values of the last
+// row of the page, so every page is a single index-friendly range scan no
+// matter how deep it is. The primary key is appended to sort as a tiebreaker
+// to keep the order stable. Sort columns should be NOT NULL.
+//
+// queryFn may add filters and joins but must not change the order or limit.
+func Paginate[ModelT any](ctx context.Context, db bun.IDB, queryFn func(q *bun.SelectQuery), sort []SortKey, cursor string, limit int) ([]*ModelT, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidLimit
+	}
+
+	var model []*ModelT
+	query, table, err := SelectQuery(ctx, db, &model)
+	if err != nil {
+		return nil, "", errs.Wrap(err, "select query")
+	}
+
+	sortFields, err := paginationSortFields(table, sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(cursor) > 0 {
+		values, err := decodeCursor(cursor, sortFields)
+		if err != nil {
+			return nil, "", err
+		}
+
+		where, args := keysetWhere(table, sortFields, values)
+		query.Where(where, args...)
+	}
+
+	for _, sf := range sortFields {
+		direction := "ASC"
+		if sf.desc {
+			direction = "DESC"
+		}
+
+		query.OrderExpr(fmt.Sprintf("%s.%s %s", table.SQLAlias, sf.field.SQLName, direction))
+	}
+
+	if queryFn != nil {
+		queryFn(query)
+	}
+
+	// Fetch one extra row to find out whether there is a next page.
+	query.Limit(limit + 1)
+
+	// The after find hooks only see the models of the page.
+	page := func() []*ModelT { return model[:min(len(model), limit)] }
+
+	err = runFind(ctx, db, query, ModelHooks[ModelT]{}, func(ctx context.Context) error {
+		err := query.Scan(ctx)
+		if err != nil {
+			return errs.Wrap(err, "scanning model")
+		}
+
+		return nil
+	}, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(model) <= limit {
+		return model, "", nil
+	}
+
+	model = page()
+
+	nextCursor, err := encodeCursor(reflect.ValueOf(model[limit-1]).Elem(), sortFields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return model, nextCursor, nil
+}
+
+func paginationSortFields(table *schema.Table, sort []SortKey) ([]sortField, error) {
+	sortFields := make([]sortField, 0, len(sort)+len(table.PKs))
+
+	for _, key := range sort {
+		field, ok := table.FieldMap[key.Column]
+		if !ok {
+			return nil, errs.Wrapf(ErrUnknownColumn, "column %s", key.Column)
+		}
+
+		sortFields = append(sortFields, sortField{field: field, desc: key.Desc})
+	}
+
+	for _, pk := range table.PKs {
+		if !slices.ContainsFunc(sortFields, func(sf sortField) bool { return sf.field == pk }) {
+			sortFields = append(sortFields, sortField{field: pk})
+		}
+	}
+
+	return sortFields, nil
+}
+
+// keysetWhere builds the condition selecting the rows that come after values
+// in the given order, e.g. for (a ASC, b DESC):
+//
+//	(a > ?) OR (a = ? AND b < ?)
+func keysetWhere(table *schema.Table, sortFields []sortField, values []any) (string, []any) {
+	conds := make([]string, 0, len(sortFields))
+	var args []any
+
+	for i, sf := range sortFields {
+		parts := make([]string, 0, i+1)
+
+		for j := range i {
+			parts = append(parts, fmt.Sprintf("%s.%s = ?", table.SQLAlias, sortFields[j].field.SQLName))
+			args = append(args, values[j])
+		}
+
+		op := ">"
+		if sf.desc {
+			op = "<"
+		}
+
+		parts = append(parts, fmt.Sprintf("%s.%s %s ?", table.SQLAlias, sf.field.SQLName, op))
+		args = append(args, values[i])
+
+		conds = append(conds, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return strings.Join(conds, " OR "), args
+}
+
+func encodeCursor(strct reflect.Value, sortFields []sortField) (string, error) {
+	values := make([]any, 0, len(sortFields))
+	for _, sf := range sortFields {
+		values = append(values, sf.field.Value(strct).Interface())
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", errs.Wrap(err, "encoding cursor")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string, sortFields []sortField) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var raw []json.RawMessage
+	err = json.Unmarshal(b, &raw)
+	if err != nil || len(raw) != len(sortFields) {
+		return nil, ErrInvalidCursor
+	}
+
+	// Decode each value into the Go type of its column so it is bound with the
+	// right type in the query.
+	values := make([]any, 0, len(raw))
+	for i, sf := range sortFields {
+		value := reflect.New(sf.field.IndirectType)
+
+		err = json.Unmarshal(raw[i], value.Interface())
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		values = append(values, value.Elem().Interface())
+	}
+
+	return values, nil
+}
@@ -0,0 +1,165 @@
+package bao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+func insertPaginateModels(t *testing.T, db *bun.DB, names ...string) []*testModel {
+	assert := assert.New(t)
+
+	models := make([]*testModel, 0, len(names))
+	for _, name := range names {
+		models = append(models, &testModel{
+			ID:   uuid.New().String(),
+			Name: name,
+		})
+	}
+
+	_, err := db.NewInsert().Model(&models).Exec(context.Background())
+	assert.NoError(err)
+
+	return models
+}
+
+func TestPaginate(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertPaginateModels(t, db, "c", "a", "e", "b", "d")
+
+	sort := []SortKey{{Column: "name"}}
+
+	var names []string
+	var cursor string
+	var pages int
+	for {
+		models, nextCursor, err := Paginate[testModel](context.Background(), db, nil, sort, cursor, 2)
+		assert.NoError(err)
+
+		for _, model := range models {
+			names = append(names, model.Name)
+		}
+
+		pages++
+
+		if len(nextCursor) == 0 {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	assert.Equal(3, pages)
+	assert.Equal([]string{"a", "b", "c", "d", "e"}, names)
+}
+
+func TestPaginate_desc(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertPaginateModels(t, db, "c", "a", "b")
+
+	sort := []SortKey{{Column: "name", Desc: true}}
+
+	models, cursor, err := Paginate[testModel](context.Background(), db, nil, sort, "", 2)
+	assert.NoError(err)
+	assert.Len(models, 2)
+	assert.Equal("c", models[0].Name)
+	assert.Equal("b", models[1].Name)
+	assert.NotEmpty(cursor)
+
+	models, cursor, err = Paginate[testModel](context.Background(), db, nil, sort, cursor, 2)
+	assert.NoError(err)
+	assert.Len(models, 1)
+	assert.Equal("a", models[0].Name)
+	assert.Empty(cursor)
+}
+
+func TestPaginate_ties(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	inserted := insertPaginateModels(t, db, "a", "a", "a", "a")
+
+	sort := []SortKey{{Column: "name"}}
+
+	seen := make(map[string]bool)
+	var cursor string
+	for {
+		models, nextCursor, err := Paginate[testModel](context.Background(), db, nil, sort, cursor, 3)
+		assert.NoError(err)
+
+		for _, model := range models {
+			assert.False(seen[model.ID])
+			seen[model.ID] = true
+		}
+
+		if len(nextCursor) == 0 {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	assert.Len(seen, len(inserted))
+}
+
+func TestPaginate_query(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertPaginateModels(t, db, "a", "b", "c", "d")
+
+	sort := []SortKey{{Column: "name"}}
+	queryFn := func(q *bun.SelectQuery) {
+		q.Where("name <> ?", "b")
+	}
+
+	models, cursor, err := Paginate[testModel](context.Background(), db, queryFn, sort, "", 2)
+	assert.NoError(err)
+	assert.Len(models, 2)
+	assert.Equal("a", models[0].Name)
+	assert.Equal("c", models[1].Name)
+
+	models, cursor, err = Paginate[testModel](context.Background(), db, queryFn, sort, cursor, 2)
+	assert.NoError(err)
+	assert.Len(models, 1)
+	assert.Equal("d", models[0].Name)
+	assert.Empty(cursor)
+}
+
+func TestPaginate_invalid_cursor(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, _, err := Paginate[testModel](context.Background(), db, nil, []SortKey{{Column: "name"}}, "not-a-cursor", 2)
+	assert.ErrorIs(err, ErrInvalidCursor)
+}
+
+func TestPaginate_invalid_limit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, _, err := Paginate[testModel](context.Background(), db, nil, nil, "", 0)
+	assert.ErrorIs(err, ErrInvalidLimit)
+}
+
+func TestPaginate_unknown_column(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, _, err := Paginate[testModel](context.Background(), db, nil, []SortKey{{Column: "foo"}}, "", 2)
+	assert.ErrorIs(err, ErrUnknownColumn)
+}
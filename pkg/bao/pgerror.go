@@ -0,0 +1,134 @@
+package bao
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+const (
+	pgCodeSerializationFailure = "40001"
+	pgCodeDeadlockDetected     = "40P01"
+	pgCodeForeignKeyViolation  = "23503"
+	pgCodeUniqueViolation      = "23505"
+	pgCodeCheckViolation       = "23514"
+)
+
+// pgError is the subset of a Postgres error bao cares about. bun can run on
+// top of either its own pgdriver or pgx (see infra.DB), so errors from both
+// drivers are normalized into this type.
+type pgError struct {
+	code       string
+	constraint string
+	table      string
+}
+
+func asPgError(err error) (*pgError, bool) {
+	var driverErr pgdriver.Error
+	if errors.As(err, &driverErr) {
+		return &pgError{
+			code:       driverErr.Field('C'),
+			constraint: driverErr.Field('n'),
+			table:      driverErr.Field('t'),
+		}, true
+	}
+
+	var pgxErr *pgconn.PgError
+	if errors.As(err, &pgxErr) {
+		return &pgError{
+			code:       pgxErr.Code,
+			constraint: pgxErr.ConstraintName,
+			table:      pgxErr.TableName,
+		}, true
+	}
+
+	return nil, false
+}
+
+func isRetryableTrxError(err error) bool {
+	pgErr, ok := asPgError(err)
+	if !ok {
+		return false
+	}
+
+	return pgErr.code == pgCodeSerializationFailure || pgErr.code == pgCodeDeadlockDetected
+}
+
+// ConstraintError is returned by the write operations when Postgres rejects a
+// write because it violates a constraint. It matches ErrUniqueViolation,
+// ErrForeignKeyViolation or ErrCheckViolation with errors.Is, and unwraps to
+// the original error so the driver error can still be extracted.
+type ConstraintError struct {
+	Constraint string
+	Table      string
+	Err        error
+
+	kind error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// asConstraintError wraps err in a ConstraintError if it is caused by a
+// constraint violation and returns it unchanged otherwise.
+func asConstraintError(err error) error {
+	pgErr, ok := asPgError(err)
+	if !ok {
+		return err
+	}
+
+	var kind error
+	switch pgErr.code {
+	case pgCodeUniqueViolation:
+		kind = ErrUniqueViolation
+	case pgCodeForeignKeyViolation:
+		kind = ErrForeignKeyViolation
+	case pgCodeCheckViolation:
+		kind = ErrCheckViolation
+	default:
+		return err
+	}
+
+	return &ConstraintError{
+		Constraint: pgErr.constraint,
+		Table:      pgErr.table,
+		Err:        err,
+		kind:       kind,
+	}
+}
+
+// notFoundError is a sql.ErrNoRows that also matches ErrNotFound.
+type notFoundError struct {
+	err error
+}
+
+func (e *notFoundError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e *notFoundError) Unwrap() error {
+	return e.err
+}
+
+func asNotFound(err error) error {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return &notFoundError{err: err}
+}
@@ -0,0 +1,92 @@
+package bao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+func TestCreate_unique_violation(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Create(context.Background(), db, insertModel, nil, nil)
+	assert.ErrorIs(err, ErrUniqueViolation)
+	assert.NotErrorIs(err, ErrForeignKeyViolation)
+
+	var constraintErr *ConstraintError
+	assert.ErrorAs(err, &constraintErr)
+	assert.Equal("test_models_pkey", constraintErr.Constraint)
+	assert.Equal("test_models", constraintErr.Table)
+
+	// The driver error is still reachable.
+	pgErr := &pgdriver.Error{}
+	assert.ErrorAs(err, pgErr)
+}
+
+func TestCreate_foreign_key_violation(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, err := db.ExecContext(context.Background(), "ALTER TABLE test_related_models ADD CONSTRAINT test_related_models_test_model_id_fkey FOREIGN KEY (test_model_id) REFERENCES test_models (id)")
+	assert.NoError(err)
+
+	err = Create(context.Background(), db, &testRelatedModel{
+		ID:          uuid.New().String(),
+		TestModelID: uuid.New().String(),
+	}, nil, nil)
+	assert.ErrorIs(err, ErrForeignKeyViolation)
+
+	var constraintErr *ConstraintError
+	assert.ErrorAs(err, &constraintErr)
+	assert.Equal("test_related_models_test_model_id_fkey", constraintErr.Constraint)
+	assert.Equal("test_related_models", constraintErr.Table)
+}
+
+func TestUpdate_check_violation(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, err := db.ExecContext(context.Background(), "ALTER TABLE test_models ADD CONSTRAINT test_models_name_check CHECK (name <> 'invalid')")
+	assert.NoError(err)
+
+	insertModel := &testModel{
+		ID: uuid.New().String(),
+	}
+	err = Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	insertModel.Name = "invalid"
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.ErrorIs(err, ErrCheckViolation)
+
+	var constraintErr *ConstraintError
+	assert.ErrorAs(err, &constraintErr)
+	assert.Equal("test_models_name_check", constraintErr.Constraint)
+}
+
+func TestCreateMany_unique_violation(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New().String()
+	err := CreateMany(context.Background(), db, []*testModel{{ID: id}, {ID: id}}, nil, nil)
+	assert.ErrorIs(err, ErrUniqueViolation)
+
+	var modelErr *ModelError
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(1, modelErr.Index)
+}
@@ -0,0 +1,87 @@
+package bao
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+)
+
+// ModelHooks are the hooks of a model type. Save hooks run on Create, Update,
+// UpdateColumns, Upsert, CreateMany and UpdateMany and delete hooks on Delete
+// and DeleteMany. Event hooks run on all of them, after the save or delete
+// hooks. Find hooks run on Find, FindFirst, FindAndCount, FindByID,
+// FindByIDForUpdate, FindByKey, FindByKeyForUpdate and Paginate.
+type ModelHooks[ModelT any] struct {
+	BeforeSave   []hook.Before[ModelT]
+	AfterSave    []hook.After[ModelT]
+	BeforeDelete []hook.Before[ModelT]
+	AfterDelete  []hook.After[ModelT]
+	BeforeEvent  []hook.BeforeEvent[ModelT]
+	AfterEvent   []hook.AfterEvent[ModelT]
+	BeforeFind   []hook.BeforeFind[ModelT]
+	AfterFind    []hook.AfterFind[ModelT]
+}
+
+// merge returns the hooks of h followed by the hooks of other.
+func (h ModelHooks[ModelT]) merge(other ModelHooks[ModelT]) ModelHooks[ModelT] {
+	return ModelHooks[ModelT]{
+		BeforeSave:   slices.Concat(h.BeforeSave, other.BeforeSave),
+		AfterSave:    slices.Concat(h.AfterSave, other.AfterSave),
+		BeforeDelete: slices.Concat(h.BeforeDelete, other.BeforeDelete),
+		AfterDelete:  slices.Concat(h.AfterDelete, other.AfterDelete),
+		BeforeEvent:  slices.Concat(h.BeforeEvent, other.BeforeEvent),
+		AfterEvent:   slices.Concat(h.AfterEvent, other.AfterEvent),
+		BeforeFind:   slices.Concat(h.BeforeFind, other.BeforeFind),
+		AfterFind:    slices.Concat(h.AfterFind, other.AfterFind),
+	}
+}
+
+func (h ModelHooks[ModelT]) hasEvents() bool {
+	return len(h.BeforeEvent) > 0 || len(h.AfterEvent) > 0
+}
+
+var registry = struct {
+	sync.RWMutex
+	hooks map[reflect.Type]any
+}{
+	hooks: make(map[reflect.Type]any),
+}
+
+// RegisterHooks registers hooks that run on every write of ModelT, before
+// the hooks of a Repository and the hooks passed to a call. Registering hooks
+// for the same model type again appends to the registered hooks. It is meant
+// to be called at startup.
+func RegisterHooks[ModelT any](hooks ModelHooks[ModelT]) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	rType := reflect.TypeFor[ModelT]()
+
+	registered, _ := registry.hooks[rType].(ModelHooks[ModelT])
+	registry.hooks[rType] = registered.merge(hooks)
+}
+
+func registeredHooks[ModelT any]() ModelHooks[ModelT] {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	hooks, _ := registry.hooks[reflect.TypeFor[ModelT]()].(ModelHooks[ModelT])
+
+	return hooks
+}
+
+// unregisterHooks removes the registered hooks of ModelT.
+func unregisterHooks[ModelT any]() {
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.hooks, reflect.TypeFor[ModelT]())
+}
+
+// withRegisteredHooks returns the registered hooks of ModelT followed by
+// hooks.
+func withRegisteredHooks[ModelT any](hooks ModelHooks[ModelT]) ModelHooks[ModelT] {
+	return registeredHooks[ModelT]().merge(hooks)
+}
@@ -0,0 +1,203 @@
+package bao
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+func TestRegisterHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var calls []string
+	before := func(name string) hook.Before[testPatchModel] {
+		return func(ctx context.Context, db bun.IDB, model *testPatchModel) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	after := func(name string) hook.After[testPatchModel] {
+		return func(ctx context.Context, model *testPatchModel) {
+			calls = append(calls, name)
+		}
+	}
+
+	RegisterHooks(ModelHooks[testPatchModel]{
+		BeforeSave:   []hook.Before[testPatchModel]{before("registered before save")},
+		AfterSave:    []hook.After[testPatchModel]{after("registered after save")},
+		BeforeDelete: []hook.Before[testPatchModel]{before("registered before delete")},
+		AfterDelete:  []hook.After[testPatchModel]{after("registered after delete")},
+	})
+	t.Cleanup(unregisterHooks[testPatchModel])
+
+	model := &testPatchModel{
+		ID: uuid.New().String(),
+	}
+
+	err := Create(context.Background(), db, model, []hook.Before[testPatchModel]{before("before call")}, []hook.After[testPatchModel]{after("after call")})
+	assert.NoError(err)
+	assert.Equal([]string{"registered before save", "before call", "registered after save", "after call"}, calls)
+
+	calls = nil
+	repo := NewRepository(db, WithBeforeSaveHooks(before("repository before save")))
+	err = repo.Update(context.Background(), model, []hook.Before[testPatchModel]{before("before call")}, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"registered before save", "repository before save", "before call", "registered after save"}, calls)
+
+	calls = nil
+	err = UpdateMany(context.Background(), db, []*testPatchModel{model}, nil, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"registered before save", "registered after save"}, calls)
+
+	calls = nil
+	err = Delete(context.Background(), db, model, nil, nil, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"registered before delete", "registered after delete"}, calls)
+}
+
+func TestRegisterHooks_append(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	hookErr := errors.New("test")
+
+	var called bool
+	RegisterHooks(ModelHooks[testPatchModel]{
+		BeforeSave: []hook.Before[testPatchModel]{func(ctx context.Context, db bun.IDB, model *testPatchModel) error {
+			called = true
+			return nil
+		}},
+	})
+	RegisterHooks(ModelHooks[testPatchModel]{
+		BeforeSave: []hook.Before[testPatchModel]{func(ctx context.Context, db bun.IDB, model *testPatchModel) error {
+			return hookErr
+		}},
+	})
+	t.Cleanup(unregisterHooks[testPatchModel])
+
+	err := Create(context.Background(), db, &testPatchModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, hookErr)
+	assert.True(called)
+
+	models, err := Find[testPatchModel](context.Background(), db, nil)
+	assert.NoError(err)
+	assert.Empty(models)
+}
+
+func TestRegisterHooks_find(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	foo := &testPatchModel{ID: uuid.New().String(), Name: "foo"}
+	bar := &testPatchModel{ID: uuid.New().String(), Name: "bar"}
+	err := CreateMany(context.Background(), db, []*testPatchModel{foo, bar}, nil, nil)
+	assert.NoError(err)
+
+	var loaded []*testPatchModel
+	RegisterHooks(ModelHooks[testPatchModel]{
+		BeforeFind: []hook.BeforeFind[testPatchModel]{
+			hook.LocalParameterBeforeFindHook[testPatchModel](func(ctx context.Context) map[string]string {
+				return map[string]string{"myapp.name": "foo"}
+			}),
+			func(ctx context.Context, db bun.IDB, query *bun.SelectQuery) error {
+				// The local parameter is set in the transaction the query runs in.
+				query.Where("name = current_setting('myapp.name')")
+				return nil
+			},
+		},
+		AfterFind: []hook.AfterFind[testPatchModel]{func(ctx context.Context, models []*testPatchModel) error {
+			loaded = append(loaded, models...)
+			return nil
+		}},
+	})
+	t.Cleanup(unregisterHooks[testPatchModel])
+
+	models, err := Find[testPatchModel](context.Background(), db, nil)
+	assert.NoError(err)
+	assert.Equal([]*testPatchModel{foo}, models)
+	assert.Equal(models, loaded)
+
+	model, err := FindByID[testPatchModel](context.Background(), db, foo.ID, nil)
+	assert.NoError(err)
+	assert.Equal(foo, model)
+
+	_, err = FindByIDForUpdate[testPatchModel](context.Background(), db, bar.ID, false, nil)
+	assert.ErrorIs(err, ErrNotFound)
+
+	model, err = FindFirst[testPatchModel](context.Background(), db, nil)
+	assert.NoError(err)
+	assert.Equal(foo, model)
+	assert.Len(loaded, 3)
+}
+
+func TestRegisterHooks_find_count_paginate(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	models := []*testPatchModel{
+		{ID: uuid.New().String(), Name: "foo"},
+		{ID: uuid.New().String(), Name: "foo"},
+		{ID: uuid.New().String(), Name: "bar"},
+	}
+	err := CreateMany(context.Background(), db, models, nil, nil)
+	assert.NoError(err)
+
+	var loaded []*testPatchModel
+	RegisterHooks(ModelHooks[testPatchModel]{
+		BeforeFind: []hook.BeforeFind[testPatchModel]{func(ctx context.Context, db bun.IDB, query *bun.SelectQuery) error {
+			query.Where("name = ?", "foo")
+			return nil
+		}},
+		AfterFind: []hook.AfterFind[testPatchModel]{func(ctx context.Context, models []*testPatchModel) error {
+			loaded = append(loaded, models...)
+			return nil
+		}},
+	})
+	t.Cleanup(unregisterHooks[testPatchModel])
+
+	found, count, err := FindAndCount[testPatchModel](context.Background(), db, nil, 10, 0)
+	assert.NoError(err)
+	assert.Len(found, 2)
+	assert.Equal(2, count)
+	assert.Equal(found, loaded)
+
+	loaded = nil
+
+	page, next, err := Paginate[testPatchModel](context.Background(), db, nil, nil, "", 1)
+	assert.NoError(err)
+	assert.Len(page, 1)
+	assert.NotEmpty(next)
+	assert.Equal(page, loaded)
+}
+
+func TestRegisterHooks_find_error(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testPatchModel{ID: uuid.New().String()}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+
+	hookErr := errors.New("test")
+	RegisterHooks(ModelHooks[testPatchModel]{
+		AfterFind: []hook.AfterFind[testPatchModel]{func(ctx context.Context, models []*testPatchModel) error {
+			return hookErr
+		}},
+	})
+	t.Cleanup(unregisterHooks[testPatchModel])
+
+	found, err := FindByID[testPatchModel](context.Background(), db, model.ID, nil)
+	assert.ErrorIs(err, hookErr)
+	assert.Nil(found)
+}
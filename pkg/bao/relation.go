@@ -0,0 +1,675 @@
+package bao
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/fatih/structtag"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+/*delete false means update*/
+func relatedModels[ModelT any](ctx context.Context, db bun.IDB, model *ModelT, delete bool) error {
+	modelType := reflect.TypeFor[ModelT]()
+
+	if modelType.Kind() != reflect.Struct {
+		return ErrModelNotStruct
+	}
+
+	table := db.NewSelect().Model(model).DB().Table(modelType)
+	strct := reflect.ValueOf(model).Elem()
+
+	// Check the whole aggregate before writing anything.
+	if !delete {
+		err := checkRelationCycles(table, strct, make(map[string]struct{}))
+		if err != nil {
+			return err
+		}
+	}
+
+	return persistRelations(ctx, db, table, strct, delete, make(map[string]struct{}))
+}
+
+const (
+	onDeleteCascade  = "cascade"
+	onDeleteRestrict = "restrict"
+	onDeleteNullify  = "nullify"
+)
+
+type persistedRelation struct {
+	*schema.Relation
+	tag      *structtag.Tag
+	onDelete string
+}
+
+// persistedRelations returns the has-one, has-many and many-to-many relations
+// of table tagged bao:",persist", sorted by field name.
+func persistedRelations(table *schema.Table) ([]persistedRelation, error) {
+	var relations []persistedRelation
+
+	for _, name := range slices.Sorted(maps.Keys(table.Relations)) {
+		relation := table.Relations[name]
+
+		tags, err := structtag.Parse(string(relation.Field.StructField.Tag))
+		if err != nil {
+			return nil, errs.Wrap(err, "parsing tags")
+		}
+
+		baoTag, err := tags.Get("bao")
+		if err != nil {
+			continue
+		}
+
+		if !baoTag.HasOption("persist") {
+			continue
+		}
+
+		if relation.Type != schema.HasOneRelation && relation.Type != schema.HasManyRelation && relation.Type != schema.ManyToManyRelation {
+			continue
+		}
+
+		onDelete := onDeleteCascade
+		for _, option := range baoTag.Options {
+			if value, ok := strings.CutPrefix(option, "ondelete:"); ok {
+				onDelete = value
+			}
+		}
+
+		switch onDelete {
+		case onDeleteCascade, onDeleteRestrict, onDeleteNullify:
+		default:
+			return nil, errs.Wrapf(ErrUnknownOnDelete, "%s.%s", table.TypeName, relation.Field.GoName)
+		}
+
+		relations = append(relations, persistedRelation{Relation: relation, tag: baoTag, onDelete: onDelete})
+	}
+
+	return relations, nil
+}
+
+// checkRelationCycles returns ErrRelationCycle if a model reachable from strct
+// through persisted relations is one of its own ancestors. path holds the
+// ancestors of strct.
+func checkRelationCycles(table *schema.Table, strct reflect.Value, path map[string]struct{}) error {
+	leave, err := enterPath(path, table, strct)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	relations, err := persistedRelations(table)
+	if err != nil {
+		return err
+	}
+
+	for _, relation := range relations {
+		// The relations of many-to-many related models are not persisted.
+		if relation.Type == schema.ManyToManyRelation {
+			continue
+		}
+
+		for _, r := range relatedStructs(relation.Relation, strct) {
+			err = checkRelationCycles(relation.JoinTable, r.Elem(), path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// persistRelations persists the relations of strct and, depth first, those of
+// the related models. Parents are written before their children and children
+// are deleted before their parents. path holds the ancestors of strct.
+func persistRelations(ctx context.Context, db bun.IDB, table *schema.Table, strct reflect.Value, delete bool, path map[string]struct{}) error {
+	leave, err := enterPath(path, table, strct)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	relations, err := persistedRelations(table)
+	if err != nil {
+		return err
+	}
+
+	for _, relation := range relations {
+		if delete {
+			err = deleteRelated(ctx, db, relation, relation.onDelete, strct, path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if relation.tag.HasOption("replace") {
+			err = replaceRelated(ctx, db, relation, strct, path)
+		} else if relation.Type == schema.ManyToManyRelation {
+			err = diffM2MRelated(ctx, db, relation, strct)
+		} else {
+			err = diffHasRelated(ctx, db, relation, strct, path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteRelated applies onDelete to the related rows of strct:
+//
+//   - cascade deletes the rows of a has-one or has-many relation, along with
+//     their own persisted relations, or the join table rows of a many-to-many
+//     relation. Rows of a soft deletable model are soft deleted and, as with
+//     Delete, keep their related models.
+//   - restrict returns ErrRelatedModelsExist if there are any such rows that
+//     are not soft deleted.
+//   - nullify sets the foreign keys of the rows of a has-one or has-many
+//     relation to NULL. Join table rows are deleted.
+func deleteRelated(ctx context.Context, db bun.IDB, relation persistedRelation, onDelete string, strct reflect.Value, path map[string]struct{}) error {
+	table, where, args := relatedRowsWhere(relation, strct)
+
+	switch deletedField := softDeleteField(table); {
+	case onDelete == onDeleteRestrict:
+		exists, err := db.NewSelect().Model(reflect.New(table.Type).Interface()).Where(withoutDeleted(table, where), args...).Exists(ctx)
+		if err != nil {
+			return errs.Wrapf(err, "checking if related models exist (%s)", table.ModelName)
+		}
+
+		if exists {
+			return errs.Wrapf(ErrRelatedModelsExist, "%s", table.ModelName)
+		}
+
+		return nil
+
+	case onDelete == onDeleteNullify && relation.Type != schema.ManyToManyRelation:
+		query := db.NewUpdate().Model(reflect.New(table.Type).Interface()).Where(where, args...)
+		for _, joinField := range relation.JoinPKs {
+			query.Set(fmt.Sprintf("%s = NULL", joinField.SQLName))
+		}
+
+		_, err := query.Exec(ctx)
+		if err != nil {
+			return errs.Wrapf(err, "nullifying related models (%s)", table.ModelName)
+		}
+
+		return nil
+
+	case deletedField != nil:
+		query := db.NewUpdate().Model(reflect.New(table.Type).Interface()).Where(where, args...)
+
+		err := softDeleteRows(ctx, query, deletedField)
+		if err != nil {
+			return errs.Wrapf(err, "soft deleting related models (%s)", table.ModelName)
+		}
+
+		return nil
+
+	case relation.Type != schema.ManyToManyRelation:
+		children, err := persistedRelations(table)
+		if err != nil {
+			return err
+		}
+
+		if len(children) > 0 {
+			rows, err := selectRelated(ctx, db, table, where, args)
+			if err != nil {
+				return err
+			}
+
+			err = persistChildren(ctx, db, table, rows, path, true /*delete*/)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := db.NewDelete().Model(reflect.New(table.Type).Interface()).Where(where, args...).Exec(ctx)
+	if err != nil {
+		return errs.Wrapf(err, "deleting related models (%s)", table.ModelName)
+	}
+
+	return nil
+}
+
+// relatedRowsWhere returns the table holding the related rows of strct, the
+// join table for a many-to-many relation, and a WHERE clause matching them.
+func relatedRowsWhere(relation persistedRelation, strct reflect.Value) (*schema.Table, string, []any) {
+	if relation.Type == schema.ManyToManyRelation {
+		where, args := relationWhere(relation.M2MBasePKs, relation.BasePKs, strct)
+		return relation.M2MTable, where, args
+	}
+
+	where, args := relationWhere(relation.JoinPKs, relation.BasePKs, strct)
+
+	return relation.JoinTable, where, args
+}
+
+// replaceRelated deletes all rows of the relation and inserts the value of the
+// relation field again.
+func replaceRelated(ctx context.Context, db bun.IDB, relation persistedRelation, strct reflect.Value, path map[string]struct{}) error {
+	err := deleteRelated(ctx, db, relation, onDeleteCascade, strct, path)
+	if err != nil {
+		return err
+	}
+
+	related := relatedStructs(relation.Relation, strct)
+	// Continue if there is nothing to insert.
+	if len(related) == 0 {
+		return nil
+	}
+
+	if relation.Type == schema.ManyToManyRelation {
+		return insertM2MRelated(ctx, db, relation.Relation, strct, related)
+	}
+
+	err = insertHasRelated(ctx, db, relation.Relation, strct, related)
+	if err != nil {
+		return err
+	}
+
+	return persistChildren(ctx, db, relation.JoinTable, related, path, false /* update*/)
+}
+
+// diffHasRelated brings the rows of a has-one or has-many relation in line with
+// the value of the relation field, matching rows by primary key: new models are
+// inserted, changed models updated and missing models deleted.
+func diffHasRelated(ctx context.Context, db bun.IDB, relation persistedRelation, strct reflect.Value, path map[string]struct{}) error {
+	joinTable := relation.JoinTable
+
+	where, args := relationWhere(relation.JoinPKs, relation.BasePKs, strct)
+
+	rows, err := selectRelated(ctx, db, joinTable, withoutDeleted(joinTable, where), args)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]reflect.Value, len(rows))
+	for _, row := range rows {
+		existing[pkKey(joinTable, row.Elem())] = row
+	}
+
+	related := relatedStructs(relation.Relation, strct)
+
+	var inserts, updates []reflect.Value
+	for _, r := range related {
+		setForeignKeys(relation.Relation, strct, r)
+
+		key := pkKey(joinTable, r.Elem())
+
+		row, ok := existing[key]
+		if !ok || !hasPK(joinTable, r.Elem()) {
+			inserts = append(inserts, r)
+			continue
+		}
+
+		delete(existing, key)
+
+		if !fieldsEqual(joinTable.DataFields, row.Elem(), r.Elem()) {
+			updates = append(updates, r)
+		}
+	}
+
+	deletes := make([]reflect.Value, 0, len(existing))
+	for _, row := range existing {
+		deletes = append(deletes, row)
+	}
+
+	if deletedField := softDeleteField(joinTable); deletedField != nil && len(deletes) > 0 {
+		// As with Delete, soft deleted models keep their related models.
+		err = softDeleteRows(ctx, db.NewUpdate().Model(structSlice(joinTable, deletes)).WherePK(), deletedField)
+		if err != nil {
+			return errs.Wrapf(err, "soft deleting related models (%s)", joinTable.ModelName)
+		}
+	} else if len(deletes) > 0 {
+		err = persistChildren(ctx, db, joinTable, deletes, path, true /*delete*/)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.NewDelete().Model(structSlice(joinTable, deletes)).WherePK().Exec(ctx)
+		if err != nil {
+			return errs.Wrapf(err, "deleting related models (%s)", joinTable.ModelName)
+		}
+	}
+
+	if len(updates) > 0 {
+		err = setRowTimestamps(ctx, joinTable, updates, false)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.NewUpdate().Model(structSlice(joinTable, updates)).Column(bulkUpdateColumns(joinTable)...).Bulk().Exec(ctx)
+		if err != nil {
+			return errs.Wrapf(err, "updating related models (%s)", joinTable.ModelName)
+		}
+	}
+
+	if len(inserts) > 0 {
+		err = setRowTimestamps(ctx, joinTable, inserts, true)
+		if err != nil {
+			return err
+		}
+
+		err = setRowTenants(ctx, joinTable, inserts)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.NewInsert().Model(structSlice(joinTable, inserts)).Exec(ctx)
+		if err != nil {
+			return errs.Wrapf(err, "inserting related models (%s)", joinTable.ModelName)
+		}
+	}
+
+	return persistChildren(ctx, db, joinTable, related, path, false /* update*/)
+}
+
+// diffM2MRelated brings the join table rows of a many-to-many relation in line
+// with the value of the relation field. Join table rows are only inserted for
+// new related models and deleted for missing ones.
+func diffM2MRelated(ctx context.Context, db bun.IDB, relation persistedRelation, strct reflect.Value) error {
+	m2mTable := relation.M2MTable
+
+	where, args := relationWhere(relation.M2MBasePKs, relation.BasePKs, strct)
+
+	joins, err := selectRelated(ctx, db, m2mTable, withoutDeleted(m2mTable, where), args)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]reflect.Value, len(joins))
+	for _, join := range joins {
+		existing[fieldsKey(relation.M2MJoinPKs, join.Elem())] = join
+	}
+
+	var inserts []reflect.Value
+	for _, r := range relatedStructs(relation.Relation, strct) {
+		key := fieldsKey(relation.JoinPKs, r.Elem())
+
+		if _, ok := existing[key]; ok {
+			delete(existing, key)
+			continue
+		}
+
+		inserts = append(inserts, r)
+	}
+
+	for _, join := range existing {
+		where, args := relationWhere(relation.M2MJoinPKs, relation.M2MJoinPKs, join.Elem())
+		baseWhere, baseArgs := relationWhere(relation.M2MBasePKs, relation.M2MBasePKs, join.Elem())
+
+		if deletedField := softDeleteField(m2mTable); deletedField != nil {
+			query := db.NewUpdate().Model(reflect.New(m2mTable.Type).Interface()).Where(where, args...).Where(baseWhere, baseArgs...)
+
+			err = softDeleteRows(ctx, query, deletedField)
+			if err != nil {
+				return errs.Wrapf(err, "soft deleting join model (%s)", m2mTable.ModelName)
+			}
+
+			continue
+		}
+
+		_, err = db.NewDelete().Model(reflect.New(m2mTable.Type).Interface()).Where(where, args...).Where(baseWhere, baseArgs...).Exec(ctx)
+		if err != nil {
+			return errs.Wrapf(err, "deleting join model (%s)", m2mTable.ModelName)
+		}
+	}
+
+	if len(inserts) == 0 {
+		return nil
+	}
+
+	return insertM2MRelated(ctx, db, relation.Relation, strct, inserts)
+}
+
+// persistChildren persists the relations of the related models structs.
+func persistChildren(ctx context.Context, db bun.IDB, table *schema.Table, structs []reflect.Value, path map[string]struct{}, delete bool) error {
+	for _, r := range structs {
+		err := persistRelations(ctx, db, table, r.Elem(), delete, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selectRelated returns pointers to the rows of table matching where.
+func selectRelated(ctx context.Context, db bun.IDB, table *schema.Table, where string, args []any) ([]reflect.Value, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.PointerTo(table.Type)))
+
+	err := db.NewSelect().Model(rows.Interface()).Where(where, args...).Scan(ctx)
+	if err != nil {
+		return nil, errs.Wrapf(err, "selecting related models (%s)", table.ModelName)
+	}
+
+	values := make([]reflect.Value, 0, rows.Elem().Len())
+	for i := range rows.Elem().Len() {
+		values = append(values, rows.Elem().Index(i))
+	}
+
+	return values, nil
+}
+
+// insertHasRelated inserts the models of a has-one or has-many relation after
+// setting their foreign keys from strct.
+func insertHasRelated(ctx context.Context, db bun.IDB, relation *schema.Relation, strct reflect.Value, related []reflect.Value) error {
+	for _, r := range related {
+		setForeignKeys(relation, strct, r)
+	}
+
+	err := setRowTimestamps(ctx, relation.JoinTable, related, true)
+	if err != nil {
+		return err
+	}
+
+	err = setRowTenants(ctx, relation.JoinTable, related)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewInsert().Model(structSlice(relation.JoinTable, related)).Exec(ctx)
+	if err != nil {
+		return errs.Wrapf(err, "inserting related model (%s)", relation.JoinTable.ModelName)
+	}
+
+	return nil
+}
+
+// insertM2MRelated inserts a join table row for each of the related models of a
+// many-to-many relation. The related models are inserted if they do not exist
+// yet and are never updated, as other models may refer to them.
+func insertM2MRelated(ctx context.Context, db bun.IDB, relation *schema.Relation, strct reflect.Value, related []reflect.Value) error {
+	err := setRowTimestamps(ctx, relation.JoinTable, related, true)
+	if err != nil {
+		return err
+	}
+
+	err = setRowTenants(ctx, relation.JoinTable, related)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewInsert().Model(structSlice(relation.JoinTable, related)).On("CONFLICT DO NOTHING").Exec(ctx)
+	if err != nil {
+		return errs.Wrapf(err, "inserting related model (%s)", relation.JoinTable.ModelName)
+	}
+
+	joins := make([]reflect.Value, 0, len(related))
+	for _, r := range related {
+		join := reflect.New(relation.M2MTable.Type)
+
+		for i, m2mField := range relation.M2MBasePKs {
+			setFieldValue(m2mField.Value(join.Elem()), relation.BasePKs[i].Value(strct))
+		}
+		for i, m2mField := range relation.M2MJoinPKs {
+			setFieldValue(m2mField.Value(join.Elem()), relation.JoinPKs[i].Value(r.Elem()))
+		}
+
+		joins = append(joins, join)
+	}
+
+	err = setRowTimestamps(ctx, relation.M2MTable, joins, true)
+	if err != nil {
+		return err
+	}
+
+	err = setRowTenants(ctx, relation.M2MTable, joins)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewInsert().Model(structSlice(relation.M2MTable, joins)).Exec(ctx)
+	if err != nil {
+		return errs.Wrapf(err, "inserting join model (%s)", relation.M2MTable.ModelName)
+	}
+
+	return nil
+}
+
+// relationWhere returns a WHERE clause matching the columns fields to the
+// values of valueFields in strct.
+func relationWhere(fields, valueFields []*schema.Field, strct reflect.Value) (string, []any) {
+	conds := make([]string, 0, len(fields))
+	args := make([]any, 0, len(fields))
+
+	for i, field := range fields {
+		conds = append(conds, fmt.Sprintf("%s = ?", field.SQLName))
+		args = append(args, valueFields[i].Value(strct).Interface())
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// setForeignKeys sets the foreign keys of the related model r of a has-one or
+// has-many relation from strct.
+func setForeignKeys(relation *schema.Relation, strct, r reflect.Value) {
+	for i, joinField := range relation.JoinPKs {
+		setFieldValue(joinField.Value(r.Elem()), relation.BasePKs[i].Value(strct))
+	}
+}
+
+// relatedStructs returns pointers to the non-zero structs held by the relation
+// field of strct, which is either a struct, a pointer to a struct or a slice of
+// either.
+func relatedStructs(relation *schema.Relation, strct reflect.Value) []reflect.Value {
+	v := relation.Field.Value(strct)
+
+	var values []reflect.Value
+	if v.Kind() == reflect.Slice {
+		for i := range v.Len() {
+			values = append(values, v.Index(i))
+		}
+	} else {
+		values = append(values, v)
+	}
+
+	structs := make([]reflect.Value, 0, len(values))
+	for _, v := range values {
+		if v.IsZero() {
+			continue
+		}
+
+		if v.Kind() != reflect.Pointer {
+			v = v.Addr()
+		}
+
+		structs = append(structs, v)
+	}
+
+	return structs
+}
+
+// structSlice returns a pointer to a slice of pointers to structs, which bun
+// accepts as a model.
+func structSlice(table *schema.Table, structs []reflect.Value) any {
+	slice := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(table.Type)), 0, len(structs))
+	slice = reflect.Append(slice, structs...)
+
+	ptr := reflect.New(slice.Type())
+	ptr.Elem().Set(slice)
+
+	return ptr.Interface()
+}
+
+// fieldsKey is pkKey for an arbitrary list of fields.
+func fieldsKey(fields []*schema.Field, strct reflect.Value) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, fmt.Sprint(reflect.Indirect(field.Value(strct)).Interface()))
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// enterPath adds strct to path and returns a function removing it again.
+// Returns ErrRelationCycle if strct is already in path.
+func enterPath(path map[string]struct{}, table *schema.Table, strct reflect.Value) (func(), error) {
+	key := rowKey(table, strct)
+	if _, ok := path[key]; ok {
+		return nil, errs.Wrapf(ErrRelationCycle, "%s (%s)", table.ModelName, pkKey(table, strct))
+	}
+
+	path[key] = struct{}{}
+
+	return func() {
+		delete(path, key)
+	}, nil
+}
+
+// rowKey identifies strct by primary key, or by address when the primary key
+// has not been set yet.
+func rowKey(table *schema.Table, strct reflect.Value) string {
+	if hasPK(table, strct) {
+		return table.Name + "\x00" + pkKey(table, strct)
+	}
+
+	return fmt.Sprintf("%p", strct.Addr().Interface())
+}
+
+func hasPK(table *schema.Table, strct reflect.Value) bool {
+	for _, pk := range table.PKs {
+		if pk.HasZeroValue(strct) {
+			return false
+		}
+	}
+
+	return len(table.PKs) > 0
+}
+
+func fieldsEqual(fields []*schema.Field, a, b reflect.Value) bool {
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.Value(a).Interface(), field.Value(b).Interface()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setFieldValue sets dst to src, dereferencing or taking the address of src
+// when only one of the two fields is a pointer.
+func setFieldValue(dst, src reflect.Value) {
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case src.Kind() == reflect.Pointer && src.Type().Elem().AssignableTo(dst.Type()):
+		if !src.IsNil() {
+			dst.Set(src.Elem())
+		}
+	case dst.Kind() == reflect.Pointer && src.Type().AssignableTo(dst.Type().Elem()):
+		ptr := reflect.New(src.Type())
+		ptr.Elem().Set(src)
+		dst.Set(ptr)
+	}
+}
@@ -0,0 +1,566 @@
+package bao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+type testAggregateModel struct {
+	ID       string            `bun:",pk"`
+	Children []*testChildModel `bun:"rel:has-many,join:id=test_aggregate_model_id" bao:",persist"`
+	Tags     []*testTagModel   `bun:"m2m:test_aggregate_model_tags,join:AggregateModel=Tag" bao:",persist"`
+}
+
+type testReplaceModel struct {
+	ID       string            `bun:",pk"`
+	Children []*testChildModel `bun:"rel:has-many,join:id=test_aggregate_model_id" bao:",persist,replace"`
+}
+
+type testRestrictModel struct {
+	ID       string            `bun:",pk"`
+	Children []*testChildModel `bun:"rel:has-many,join:id=test_aggregate_model_id" bao:",persist,ondelete:restrict"`
+}
+
+type testNullifyModel struct {
+	ID       string            `bun:",pk"`
+	Children []*testChildModel `bun:"rel:has-many,join:id=test_aggregate_model_id" bao:",persist,ondelete:nullify"`
+}
+
+type testChildModel struct {
+	ID                   string `bun:",pk"`
+	TestAggregateModelID string
+	Name                 string
+	Grandchildren        []*testGrandchildModel `bun:"rel:has-many,join:id=test_child_model_id" bao:",persist"`
+}
+
+type testSoftDeleteParentModel struct {
+	ID       string                      `bun:",pk"`
+	Children []*testSoftDeleteChildModel `bun:"rel:has-many,join:id=test_soft_delete_parent_model_id" bao:",persist"`
+}
+
+type testSoftDeleteRestrictModel struct {
+	ID       string                      `bun:",pk"`
+	Children []*testSoftDeleteChildModel `bun:"rel:has-many,join:id=test_soft_delete_parent_model_id" bao:",persist,ondelete:restrict"`
+}
+
+type testSoftDeleteChildModel struct {
+	ID                          string `bun:",pk"`
+	TestSoftDeleteParentModelID string
+	Name                        string
+	DeletedAt                   time.Time `bun:",nullzero" bao:",softdelete"`
+}
+
+type testGrandchildModel struct {
+	ID               string `bun:",pk"`
+	TestChildModelID string
+	Name             string
+}
+
+type testNodeModel struct {
+	ID       string           `bun:",pk"`
+	ParentID string           `bun:",nullzero"`
+	Children []*testNodeModel `bun:"rel:has-many,join:id=parent_id" bao:",persist"`
+}
+
+type testTagModel struct {
+	ID   string `bun:",pk"`
+	Name string
+}
+
+type testAggregateModelTag struct {
+	AggregateModelID string              `bun:",pk"`
+	AggregateModel   *testAggregateModel `bun:"rel:belongs-to,join:aggregate_model_id=id"`
+	TagID            string              `bun:",pk"`
+	Tag              *testTagModel       `bun:"rel:belongs-to,join:tag_id=id"`
+}
+
+func testFindAggregateModel(t *testing.T, db bun.IDB, id string) *testAggregateModel {
+	model := &testAggregateModel{}
+	err := db.NewSelect().
+		Model(model).
+		Where("test_aggregate_model.id = ?", id).
+		Relation("Children", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("name")
+		}).
+		Relation("Tags", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("name")
+		}).
+		Scan(context.Background())
+	assert.NoError(t, err)
+
+	return model
+}
+
+// testRowVersion returns the xmin system column of a test_child_models row,
+// which changes whenever the row is written.
+func testRowVersion(t *testing.T, db bun.IDB, id string) string {
+	var xmin string
+	err := db.NewSelect().Table("test_child_models").ColumnExpr("xmin").Where("id = ?", id).Scan(context.Background(), &xmin)
+	assert.NoError(t, err)
+
+	return xmin
+}
+
+func TestCreate_related_has_many(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	id := uuid.New().String()
+	insertModel := &testAggregateModel{
+		ID: id,
+		Children: []*testChildModel{
+			{ID: uuid.New().String(), Name: "a"},
+			{ID: uuid.New().String(), Name: "b"},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	// The foreign key is set from the parent.
+	assert.Equal(id, insertModel.Children[0].TestAggregateModelID)
+
+	model := testFindAggregateModel(t, db, id)
+	assert.Equal(insertModel.Children, model.Children)
+}
+
+func TestUpdate_related_has_many(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	unchanged := &testChildModel{ID: uuid.New().String(), Name: "a"}
+	changed := &testChildModel{ID: uuid.New().String(), Name: "b"}
+	removed := &testChildModel{ID: uuid.New().String(), Name: "c"}
+
+	insertModel := &testAggregateModel{
+		ID:       uuid.New().String(),
+		Children: []*testChildModel{unchanged, changed, removed},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	unchangedVersion := testRowVersion(t, db, unchanged.ID)
+
+	changed.Name = "d"
+	insertModel.Children = []*testChildModel{
+		unchanged,
+		changed,
+		{ID: uuid.New().String(), Name: "e"},
+	}
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model := testFindAggregateModel(t, db, insertModel.ID)
+	assert.Equal(insertModel.Children, model.Children)
+
+	// Unchanged rows are not rewritten.
+	assert.Equal(unchangedVersion, testRowVersion(t, db, unchanged.ID))
+
+	exists, err := db.NewSelect().Model(removed).WherePK().Exists(context.Background())
+	assert.NoError(err)
+	assert.False(exists)
+}
+
+func TestUpdate_related_has_many_replace(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testReplaceModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{ID: uuid.New().String(), Name: "a"},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	version := testRowVersion(t, db, insertModel.Children[0].ID)
+
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	// The row is deleted and inserted again.
+	assert.NotEqual(version, testRowVersion(t, db, insertModel.Children[0].ID))
+}
+
+func TestUpdate_related_has_many_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	kept := &testSoftDeleteChildModel{ID: uuid.New().String(), Name: "a"}
+	removed := &testSoftDeleteChildModel{ID: uuid.New().String(), Name: "b"}
+
+	insertModel := &testSoftDeleteParentModel{
+		ID:       uuid.New().String(),
+		Children: []*testSoftDeleteChildModel{kept, removed},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	insertModel.Children = []*testSoftDeleteChildModel{kept}
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	// The removed child is soft deleted rather than removed.
+	stored := &testSoftDeleteChildModel{}
+	err = db.NewSelect().Model(stored).Where("id = ?", removed.ID).Scan(context.Background())
+	assert.NoError(err)
+	assert.False(stored.DeletedAt.IsZero())
+
+	deletedAt := stored.DeletedAt
+
+	// Soft deleted rows are no longer part of the relation.
+	insertModel.Children = []*testSoftDeleteChildModel{kept, {ID: uuid.New().String(), Name: "c"}}
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = db.NewSelect().Model(stored).Where("id = ?", removed.ID).Scan(context.Background())
+	assert.NoError(err)
+	assert.True(deletedAt.Equal(stored.DeletedAt))
+
+	children, err := Find[testSoftDeleteChildModel](context.Background(), db, func(q *bun.SelectQuery) {
+		q.Where("test_soft_delete_parent_model_id = ?", insertModel.ID).Order("name")
+	})
+	assert.NoError(err)
+	assert.Len(children, 2)
+	assert.Equal(kept.ID, children[0].ID)
+}
+
+func TestUpsert_related_do_nothing(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testAggregateModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{ID: uuid.New().String(), Name: "a"},
+			{ID: uuid.New().String(), Name: "b"},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	var afterCalled bool
+	after := func(ctx context.Context, model *testAggregateModel) {
+		afterCalled = true
+	}
+
+	err = Upsert(context.Background(), db, &testAggregateModel{
+		ID:       insertModel.ID,
+		Children: []*testChildModel{{ID: uuid.New().String(), Name: "c"}},
+	}, nil, []string{}, nil, []hook.After[testAggregateModel]{after})
+	assert.NoError(err)
+	assert.False(afterCalled)
+
+	// The existing row was not written, so neither were its related models.
+	model := testFindAggregateModel(t, db, insertModel.ID)
+	assert.Equal(insertModel.Children, model.Children)
+}
+
+func TestCreate_related_m2m(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	tag := &testTagModel{ID: uuid.New().String(), Name: "a"}
+	_, err := db.NewInsert().Model(tag).Exec(context.Background())
+	assert.NoError(err)
+
+	insertModel := &testAggregateModel{
+		ID: uuid.New().String(),
+		Tags: []*testTagModel{
+			tag,
+			{ID: uuid.New().String(), Name: "b"},
+		},
+	}
+	err = Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model := testFindAggregateModel(t, db, insertModel.ID)
+	assert.Equal(insertModel.Tags, model.Tags)
+}
+
+func TestUpdate_related_m2m(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testAggregateModel{
+		ID: uuid.New().String(),
+		Tags: []*testTagModel{
+			{ID: uuid.New().String(), Name: "a"},
+			{ID: uuid.New().String(), Name: "b"},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	removedTag := insertModel.Tags[0]
+	insertModel.Tags = insertModel.Tags[1:]
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model := testFindAggregateModel(t, db, insertModel.ID)
+	assert.Equal(insertModel.Tags, model.Tags)
+
+	// Only the join row is removed, the tag itself is kept.
+	exists, err := db.NewSelect().Model(removedTag).WherePK().Exists(context.Background())
+	assert.NoError(err)
+	assert.True(exists)
+}
+
+func TestCreate_related_nested(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testAggregateModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{
+				ID:   uuid.New().String(),
+				Name: "a",
+				Grandchildren: []*testGrandchildModel{
+					{ID: uuid.New().String(), Name: "a"},
+					{ID: uuid.New().String(), Name: "b"},
+				},
+			},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	model := &testAggregateModel{}
+	err = db.NewSelect().
+		Model(model).
+		Where("test_aggregate_model.id = ?", insertModel.ID).
+		Relation("Children").
+		Relation("Children.Grandchildren", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("name")
+		}).
+		Scan(context.Background())
+	assert.NoError(err)
+	assert.Equal(insertModel.Children, model.Children)
+}
+
+func TestUpdate_related_nested(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	removed := &testChildModel{
+		ID:   uuid.New().String(),
+		Name: "a",
+		Grandchildren: []*testGrandchildModel{
+			{ID: uuid.New().String(), Name: "a"},
+		},
+	}
+	kept := &testChildModel{
+		ID:   uuid.New().String(),
+		Name: "b",
+		Grandchildren: []*testGrandchildModel{
+			{ID: uuid.New().String(), Name: "b"},
+		},
+	}
+
+	insertModel := &testAggregateModel{
+		ID:       uuid.New().String(),
+		Children: []*testChildModel{removed, kept},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	kept.Grandchildren = append(kept.Grandchildren, &testGrandchildModel{ID: uuid.New().String(), Name: "c"})
+	insertModel.Children = []*testChildModel{kept}
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	var grandchildren []*testGrandchildModel
+	err = db.NewSelect().Model(&grandchildren).Order("name").Scan(context.Background())
+	assert.NoError(err)
+	assert.Equal(kept.Grandchildren, grandchildren)
+}
+
+func TestDelete_related_nested(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testAggregateModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{
+				ID: uuid.New().String(),
+				Grandchildren: []*testGrandchildModel{
+					{ID: uuid.New().String()},
+				},
+			},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, &testAggregateModel{ID: insertModel.ID}, nil, nil, nil)
+	assert.NoError(err)
+
+	count, err := db.NewSelect().Model((*testGrandchildModel)(nil)).Count(context.Background())
+	assert.NoError(err)
+	assert.Zero(count)
+}
+
+func TestCreate_related_cycle(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	parent := &testNodeModel{ID: uuid.New().String()}
+	child := &testNodeModel{ID: uuid.New().String(), Children: []*testNodeModel{parent}}
+	parent.Children = []*testNodeModel{child}
+
+	err := Create(context.Background(), db, parent, nil, nil)
+	assert.ErrorIs(err, ErrRelationCycle)
+
+	count, err := db.NewSelect().Model((*testNodeModel)(nil)).Count(context.Background())
+	assert.NoError(err)
+	assert.Zero(count)
+}
+
+func TestDelete_related_all(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testAggregateModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{ID: uuid.New().String()},
+		},
+		Tags: []*testTagModel{
+			{ID: uuid.New().String()},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+
+	count, err := db.NewSelect().Model((*testChildModel)(nil)).Count(context.Background())
+	assert.NoError(err)
+	assert.Zero(count)
+
+	count, err = db.NewSelect().Model((*testAggregateModelTag)(nil)).Count(context.Background())
+	assert.NoError(err)
+	assert.Zero(count)
+}
+
+func TestDelete_related_restrict(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testRestrictModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{ID: uuid.New().String()},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.ErrorIs(err, ErrRelatedModelsExist)
+
+	exists, err := db.NewSelect().Model(insertModel).WherePK().Exists(context.Background())
+	assert.NoError(err)
+	assert.True(exists)
+
+	insertModel.Children = nil
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+}
+
+func TestDelete_related_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	child := &testSoftDeleteChildModel{ID: uuid.New().String()}
+	insertModel := &testSoftDeleteParentModel{
+		ID:       uuid.New().String(),
+		Children: []*testSoftDeleteChildModel{child},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+
+	// The child is soft deleted rather than removed.
+	stored := &testSoftDeleteChildModel{}
+	err = db.NewSelect().Model(stored).Where("id = ?", child.ID).Scan(context.Background())
+	assert.NoError(err)
+	assert.False(stored.DeletedAt.IsZero())
+
+	_, err = FindByID[testSoftDeleteChildModel](context.Background(), db, child.ID, nil)
+	assert.ErrorIs(err, ErrNotFound)
+}
+
+func TestDelete_related_restrict_soft_deleted(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	child := &testSoftDeleteChildModel{ID: uuid.New().String()}
+	insertModel := &testSoftDeleteRestrictModel{
+		ID:       uuid.New().String(),
+		Children: []*testSoftDeleteChildModel{child},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.ErrorIs(err, ErrRelatedModelsExist)
+
+	err = Delete(context.Background(), db, child, nil, nil, nil)
+	assert.NoError(err)
+
+	// Soft deleted children do not restrict the delete.
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+}
+
+func TestDelete_related_nullify(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testNullifyModel{
+		ID: uuid.New().String(),
+		Children: []*testChildModel{
+			{ID: uuid.New().String()},
+		},
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+
+	count, err := db.NewSelect().Model((*testChildModel)(nil)).Where("test_aggregate_model_id IS NULL").Count(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, count)
+}
@@ -0,0 +1,165 @@
+package bao
+
+import (
+	"context"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/uptrace/bun"
+)
+
+// Repository binds a bun.IDB to the default hooks and query scopes of ModelT so
+// that every call applies them. The default hooks run after the hooks
+// registered with RegisterHooks and before the hooks passed to a call.
+type Repository[ModelT any] struct {
+	db     bun.IDB
+	hooks  ModelHooks[ModelT]
+	scopes []func(q *bun.SelectQuery)
+}
+
+type RepositoryOption[ModelT any] func(r *Repository[ModelT])
+
+// WithBeforeSaveHooks adds hooks that run before Create, Update and
+// UpdateColumns.
+func WithBeforeSaveHooks[ModelT any](befores ...hook.Before[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.BeforeSave = append(r.hooks.BeforeSave, befores...)
+	}
+}
+
+// WithAfterSaveHooks adds hooks that run after Create, Update and
+// UpdateColumns.
+func WithAfterSaveHooks[ModelT any](afters ...hook.After[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.AfterSave = append(r.hooks.AfterSave, afters...)
+	}
+}
+
+func WithBeforeDeleteHooks[ModelT any](befores ...hook.Before[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.BeforeDelete = append(r.hooks.BeforeDelete, befores...)
+	}
+}
+
+func WithAfterDeleteHooks[ModelT any](afters ...hook.After[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.AfterDelete = append(r.hooks.AfterDelete, afters...)
+	}
+}
+
+// WithBeforeEventHooks adds event hooks that run before Create, Update,
+// UpdateColumns and Delete.
+func WithBeforeEventHooks[ModelT any](befores ...hook.BeforeEvent[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.BeforeEvent = append(r.hooks.BeforeEvent, befores...)
+	}
+}
+
+// WithAfterEventHooks adds event hooks that run after Create, Update,
+// UpdateColumns and Delete.
+func WithAfterEventHooks[ModelT any](afters ...hook.AfterEvent[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.AfterEvent = append(r.hooks.AfterEvent, afters...)
+	}
+}
+
+// WithBeforeFindHooks adds hooks that run before Find, FindFirst, FindByID and
+// FindByIDForUpdate.
+func WithBeforeFindHooks[ModelT any](befores ...hook.BeforeFind[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.BeforeFind = append(r.hooks.BeforeFind, befores...)
+	}
+}
+
+// WithAfterFindHooks adds hooks that run after Find, FindFirst, FindByID and
+// FindByIDForUpdate.
+func WithAfterFindHooks[ModelT any](afters ...hook.AfterFind[ModelT]) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.hooks.AfterFind = append(r.hooks.AfterFind, afters...)
+	}
+}
+
+// WithScopes adds query scopes that are applied to every select query before
+// the queryFn passed to a call, e.g. to hide archived rows.
+func WithScopes[ModelT any](scopes ...func(q *bun.SelectQuery)) RepositoryOption[ModelT] {
+	return func(r *Repository[ModelT]) {
+		r.scopes = append(r.scopes, scopes...)
+	}
+}
+
+func NewRepository[ModelT any](db bun.IDB, opts ...RepositoryOption[ModelT]) *Repository[ModelT] {
+	r := &Repository[ModelT]{
+		db: db,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithDB returns a copy of r that runs on db, e.g. a transaction started by
+// Trx.
+func (r *Repository[ModelT]) WithDB(db bun.IDB) *Repository[ModelT] {
+	c := *r
+	c.db = db
+
+	return &c
+}
+
+func (r *Repository[ModelT]) DB() bun.IDB {
+	return r.db
+}
+
+func (r *Repository[ModelT]) Find(ctx context.Context, queryFn func(q *bun.SelectQuery)) ([]*ModelT, error) {
+	return find(ctx, r.db, r.scoped(queryFn), r.hooks)
+}
+
+func (r *Repository[ModelT]) FindFirst(ctx context.Context, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	return findFirst(ctx, r.db, r.scoped(queryFn), r.hooks)
+}
+
+func (r *Repository[ModelT]) FindByID(ctx context.Context, id any, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	return findByID(ctx, r.db, id, false, false, r.scoped(queryFn), r.hooks)
+}
+
+func (r *Repository[ModelT]) FindByIDForUpdate(ctx context.Context, id any, skipLocked bool, queryFn func(q *bun.SelectQuery)) (*ModelT, error) {
+	return findByID(ctx, r.db, id, true, skipLocked, r.scoped(queryFn), r.hooks)
+}
+
+func (r *Repository[ModelT]) Create(ctx context.Context, model *ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	return create(ctx, r.db, model, r.hooks.merge(ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters}))
+}
+
+func (r *Repository[ModelT]) Update(ctx context.Context, model *ModelT, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	return update(ctx, r.db, model, nil, r.hooks.merge(ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters}))
+}
+
+func (r *Repository[ModelT]) UpdateColumns(ctx context.Context, model *ModelT, columns []string, befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	if columns == nil {
+		columns = []string{}
+	}
+
+	return update(ctx, r.db, model, columns, r.hooks.merge(ModelHooks[ModelT]{BeforeSave: befores, AfterSave: afters}))
+}
+
+func (r *Repository[ModelT]) Delete(ctx context.Context, model *ModelT, queryFn func(q *bun.DeleteQuery), befores []hook.Before[ModelT], afters []hook.After[ModelT]) error {
+	return deleteModel(ctx, r.db, model, queryFn, r.hooks.merge(ModelHooks[ModelT]{BeforeDelete: befores, AfterDelete: afters}))
+}
+
+// scoped returns a queryFn that applies the scopes of r and then queryFn.
+func (r *Repository[ModelT]) scoped(queryFn func(q *bun.SelectQuery)) func(q *bun.SelectQuery) {
+	if len(r.scopes) == 0 {
+		return queryFn
+	}
+
+	return func(q *bun.SelectQuery) {
+		for _, scope := range r.scopes {
+			scope(q)
+		}
+
+		if queryFn != nil {
+			queryFn(q)
+		}
+	}
+}
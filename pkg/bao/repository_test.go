@@ -0,0 +1,144 @@
+package bao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+func TestRepository_hooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var calls []string
+	before := func(name string) hook.Before[testModel] {
+		return func(ctx context.Context, db bun.IDB, model *testModel) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	after := func(name string) hook.After[testModel] {
+		return func(ctx context.Context, model *testModel) {
+			calls = append(calls, name)
+		}
+	}
+
+	repo := NewRepository(db,
+		WithBeforeSaveHooks(before("before save")),
+		WithAfterSaveHooks(after("after save")),
+		WithBeforeDeleteHooks(before("before delete")),
+		WithAfterDeleteHooks(after("after delete")),
+	)
+
+	model := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	err := repo.Create(context.Background(), model, []hook.Before[testModel]{before("before call")}, []hook.After[testModel]{after("after call")})
+	assert.NoError(err)
+	assert.Equal([]string{"before save", "before call", "after save", "after call"}, calls)
+
+	calls = nil
+	model.Name = "foo"
+	err = repo.Update(context.Background(), model, nil, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"before save", "after save"}, calls)
+
+	calls = nil
+	err = repo.Delete(context.Background(), model, nil, nil, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"before delete", "after delete"}, calls)
+}
+
+func TestRepository_scopes(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	foo := &testModel{ID: uuid.New().String(), Name: "foo"}
+	bar := &testModel{ID: uuid.New().String(), Name: "bar"}
+	err := CreateMany(context.Background(), db, []*testModel{foo, bar}, nil, nil)
+	assert.NoError(err)
+
+	repo := NewRepository(db, WithScopes[testModel](func(q *bun.SelectQuery) {
+		q.Where("name = ?", "foo")
+	}))
+
+	models, err := repo.Find(context.Background(), nil)
+	assert.NoError(err)
+	assert.Equal([]*testModel{foo}, models)
+
+	model, err := repo.FindByID(context.Background(), foo.ID, nil)
+	assert.NoError(err)
+	assert.Equal(foo, model)
+
+	_, err = repo.FindByID(context.Background(), bar.ID, nil)
+	assert.ErrorIs(err, ErrNotFound)
+
+	// Scopes are applied before the queryFn of the call.
+	_, err = repo.FindFirst(context.Background(), func(q *bun.SelectQuery) {
+		q.Where("id = ?", bar.ID)
+	})
+	assert.ErrorIs(err, ErrNotFound)
+}
+
+func TestRepository_WithDB(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	repo := NewRepository[testModel](db)
+
+	model := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		txRepo := repo.WithDB(tx)
+		assert.Equal(tx, txRepo.DB())
+		assert.Equal(db, repo.DB())
+
+		return txRepo.Create(ctx, model, nil, nil)
+	})
+	assert.NoError(err)
+
+	found, err := repo.FindByID(context.Background(), model.ID, nil)
+	assert.NoError(err)
+	assert.Equal(model, found)
+}
+
+func TestRepository_find_hooks(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testModel{ID: uuid.New().String()}
+	err := Create(context.Background(), db, model, nil, nil)
+	assert.NoError(err)
+
+	var calls []string
+	repo := NewRepository(db,
+		WithBeforeFindHooks[testModel](func(ctx context.Context, db bun.IDB, query *bun.SelectQuery) error {
+			calls = append(calls, "before find")
+			return nil
+		}),
+		WithAfterFindHooks(func(ctx context.Context, models []*testModel) error {
+			for _, model := range models {
+				model.Name = "decrypted"
+			}
+
+			calls = append(calls, "after find")
+			return nil
+		}),
+	)
+
+	found, err := repo.FindByID(context.Background(), model.ID, nil)
+	assert.NoError(err)
+	assert.Equal("decrypted", found.Name)
+	assert.Equal([]string{"before find", "after find"}, calls)
+}
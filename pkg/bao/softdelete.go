@@ -0,0 +1,117 @@
+package bao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+type withDeletedKey struct{}
+
+// WithDeleted returns a copy of ctx that makes bao queries include rows that
+// have been soft deleted.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey{}, true)
+}
+
+func includeDeleted(ctx context.Context) bool {
+	v, _ := ctx.Value(withDeletedKey{}).(bool)
+	return v
+}
+
+// softDeleteField returns the column tagged bao:",softdelete" or nil if the
+// model is not soft deletable.
+func softDeleteField(table *schema.Table) *schema.Field {
+	return taggedField(table, "softdelete")
+}
+
+func whereNotDeleted(ctx context.Context, query *bun.SelectQuery, table *schema.Table) {
+	field := softDeleteField(table)
+	if field == nil || includeDeleted(ctx) {
+		return
+	}
+
+	query.Where(fmt.Sprintf("%s.%s IS NULL", table.SQLAlias, field.SQLName))
+}
+
+// withoutDeleted adds a condition excluding the soft deleted rows of table to
+// where.
+func withoutDeleted(table *schema.Table, where string) string {
+	field := softDeleteField(table)
+	if field == nil {
+		return where
+	}
+
+	return fmt.Sprintf("(%s) AND %s IS NULL", where, field.SQLName)
+}
+
+// softDeleteRows sets the soft delete column of the rows matched by query that
+// are not soft deleted yet.
+func softDeleteRows(ctx context.Context, query *bun.UpdateQuery, field *schema.Field) error {
+	_, err := query.
+		Set(fmt.Sprintf("%s = ?", field.SQLName), now(ctx)).
+		Where(fmt.Sprintf("%s IS NULL", field.SQLName)).
+		Exec(ctx)
+
+	return err
+}
+
+// softDelete sets the soft delete column of model and writes it. Rows that are
+// already soft deleted keep their original deletion time.
+func softDelete[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, field *schema.Field, model *ModelT) error {
+	err := setTimeField(field, reflect.ValueOf(model).Elem(), now(ctx))
+	if err != nil {
+		return err
+	}
+
+	query := tx.NewUpdate().
+		Model(model).
+		Column(field.Name).
+		WherePK().
+		Where(fmt.Sprintf("%s IS NULL", field.SQLName))
+
+	err = whereTenant(ctx, query, table)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.Exec(ctx)
+	if err != nil {
+		return errs.Wrap(err, "soft deleting model")
+	}
+
+	return nil
+}
+
+func softDeleteMany[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, field *schema.Field, models []*ModelT) error {
+	t := now(ctx)
+
+	for _, model := range models {
+		err := setTimeField(field, reflect.ValueOf(model).Elem(), t)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := tx.NewUpdate().
+		Model(&models).
+		Set(fmt.Sprintf("%s = ?", field.SQLName), t).
+		WherePK().
+		Where(fmt.Sprintf("%s IS NULL", field.SQLName))
+
+	err := whereTenant(ctx, query, table)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.Exec(ctx)
+	if err != nil {
+		return errs.Wrap(err, "soft deleting models")
+	}
+
+	return nil
+}
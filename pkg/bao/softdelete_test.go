@@ -0,0 +1,175 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+type testSoftDeleteModel struct {
+	ID        string `bun:",pk"`
+	Name      string
+	DeletedAt time.Time `bun:",nullzero" bao:",softdelete"`
+}
+
+func TestDelete_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+	assert.False(insertModel.DeletedAt.IsZero())
+
+	model := &testSoftDeleteModel{}
+	err = db.NewSelect().Model(model).Where("id = ?", insertModel.ID).Scan(context.Background())
+	assert.NoError(err)
+	assert.False(model.DeletedAt.IsZero())
+}
+
+func TestDelete_soft_delete_query(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, func(q *bun.DeleteQuery) {
+		q.Where("name = ?", "foo")
+	}, nil, nil)
+	assert.ErrorIs(err, ErrSoftDeleteQuery)
+}
+
+func TestDeleteMany_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModels := []*testSoftDeleteModel{
+		{ID: uuid.New().String()},
+		{ID: uuid.New().String()},
+	}
+	err := CreateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	err = DeleteMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	count, err := db.NewSelect().Model((*testSoftDeleteModel)(nil)).Where("deleted_at IS NOT NULL").Count(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, count)
+}
+
+func TestFind_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	deletedModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, deletedModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, deletedModel, nil, nil, nil)
+	assert.NoError(err)
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err = Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	models, err := Find[testSoftDeleteModel](context.Background(), db, nil)
+	assert.NoError(err)
+	assert.Len(models, 1)
+	assert.Equal(insertModel.ID, models[0].ID)
+
+	models, err = Find[testSoftDeleteModel](WithDeleted(context.Background()), db, nil)
+	assert.NoError(err)
+	assert.Len(models, 2)
+}
+
+func TestFindFirst_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindFirst[testSoftDeleteModel](context.Background(), db, nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, sql.ErrNoRows)
+
+	model, err = FindFirst[testSoftDeleteModel](WithDeleted(context.Background()), db, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel.ID, model.ID)
+}
+
+func TestFindByID_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testSoftDeleteModel](context.Background(), db, insertModel.ID, nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, sql.ErrNoRows)
+
+	model, err = FindByID[testSoftDeleteModel](WithDeleted(context.Background()), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel.ID, model.ID)
+}
+
+func TestFindByIDForUpdate_soft_delete(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(context.Background(), db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByIDForUpdate[testSoftDeleteModel](context.Background(), db, insertModel.ID, false, nil)
+	assert.Nil(model)
+	assert.ErrorIs(err, sql.ErrNoRows)
+
+	model, err = FindByIDForUpdate[testSoftDeleteModel](WithDeleted(context.Background()), db, insertModel.ID, false, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel.ID, model.ID)
+}
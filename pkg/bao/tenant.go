@@ -0,0 +1,222 @@
+package bao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+type tenantKey struct{}
+
+type tenant struct {
+	id        any
+	parameter string
+}
+
+type TenantOption func(t *tenant)
+
+// WithTenantParameter makes the transactions bao starts set the Postgres
+// parameter name to the tenant ID with SET LOCAL, e.g. for a row level security
+// policy to read with current_setting(name). Find queries then also run in a
+// transaction.
+func WithTenantParameter(name string) TenantOption {
+	return func(t *tenant) {
+		t.parameter = name
+	}
+}
+
+// WithTenant returns a copy of ctx that scopes bao to the tenant id. Models
+// with a column tagged bao:",tenant" are only read, updated and deleted when
+// that column matches id and are created with the column set to id. Using such
+// a model with a ctx that has no tenant, or a zero id, returns ErrNoTenant.
+func WithTenant(ctx context.Context, id any, opts ...TenantOption) context.Context {
+	t := &tenant{
+		id: id,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// TenantFromContext returns the tenant ID set with WithTenant.
+func TenantFromContext(ctx context.Context) (any, bool) {
+	t, ok := tenantFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	return t.id, true
+}
+
+func tenantFromContext(ctx context.Context) (*tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(*tenant)
+	if !ok {
+		return nil, false
+	}
+
+	rValue := reflect.Indirect(reflect.ValueOf(t.id))
+	if !rValue.IsValid() || rValue.IsZero() {
+		return nil, false
+	}
+
+	return t, true
+}
+
+// tenantParameter returns the name and value of the parameter to set for the
+// tenant of ctx, see WithTenantParameter.
+func tenantParameter(ctx context.Context) (string, string, bool) {
+	t, ok := tenantFromContext(ctx)
+	if !ok || len(t.parameter) == 0 {
+		return "", "", false
+	}
+
+	return t.parameter, fmt.Sprint(reflect.Indirect(reflect.ValueOf(t.id)).Interface()), true
+}
+
+// tenantField returns the column tagged bao:",tenant" or nil if the model is
+// not scoped to a tenant.
+func tenantField(table *schema.Table) *schema.Field {
+	return taggedField(table, "tenant")
+}
+
+// tenantValue returns the tenant of ctx converted to the type of field.
+func tenantValue(ctx context.Context, field *schema.Field) (reflect.Value, error) {
+	t, ok := tenantFromContext(ctx)
+	if !ok {
+		return reflect.Value{}, errs.Wrapf(ErrNoTenant, "column %s", field.Name)
+	}
+
+	rValue := reflect.Indirect(reflect.ValueOf(t.id))
+	fieldType := field.IndirectType
+
+	if isUUIDField(field) && rValue.Kind() == reflect.String {
+		id, err := uuid.Parse(rValue.String())
+		if err != nil {
+			return reflect.Value{}, errs.Wrapf(ErrInvalidTenant, "column %s: %s is not a valid UUID", field.Name, rValue.String())
+		}
+
+		if fieldType.Kind() != reflect.String {
+			rValue = reflect.ValueOf(id)
+		}
+	}
+
+	vType := rValue.Type()
+
+	switch {
+	case vType == fieldType:
+		return rValue, nil
+
+	case isIntKind(vType.Kind()) && isIntKind(fieldType.Kind()):
+		// Converting would wrap around to another tenant.
+		if !intFits(rValue, fieldType) {
+			return reflect.Value{}, errs.Wrapf(ErrInvalidTenant, "column %s: %v is out of range for %s", field.Name, rValue.Interface(), fieldType)
+		}
+
+		return rValue.Convert(fieldType), nil
+
+	case vType.ConvertibleTo(fieldType) && vType.Kind() == fieldType.Kind():
+		return rValue.Convert(fieldType), nil
+	}
+
+	return reflect.Value{}, errs.Wrapf(ErrInvalidTenant, "column %s: %s is not a %s", field.Name, vType, fieldType)
+}
+
+// requireTenant returns ErrNoTenant when table is scoped to a tenant and ctx
+// has none.
+func requireTenant(ctx context.Context, table *schema.Table) error {
+	field := tenantField(table)
+	if field == nil {
+		return nil
+	}
+
+	_, err := tenantValue(ctx, field)
+
+	return err
+}
+
+// whereTenant limits query to the rows of the tenant of ctx when table is
+// scoped to a tenant.
+func whereTenant[QueryT interface {
+	Where(query string, args ...any) QueryT
+}](ctx context.Context, query QueryT, table *schema.Table) error {
+	field := tenantField(table)
+	if field == nil {
+		return nil
+	}
+
+	value, err := tenantValue(ctx, field)
+	if err != nil {
+		return err
+	}
+
+	query.Where(fmt.Sprintf("%s.%s = ?", table.SQLAlias, field.SQLName), value.Interface())
+
+	return nil
+}
+
+// setTenant sets the tenant column of strct to the tenant of ctx. Returns
+// ErrTenantMismatch if the column is already set to another tenant.
+func setTenant(ctx context.Context, table *schema.Table, strct reflect.Value) error {
+	field := tenantField(table)
+	if field == nil {
+		return nil
+	}
+
+	value, err := tenantValue(ctx, field)
+	if err != nil {
+		return err
+	}
+
+	fv := field.Value(strct)
+
+	if !field.HasZeroValue(strct) {
+		if !reflect.DeepEqual(reflect.Indirect(fv).Interface(), value.Interface()) {
+			return errs.Wrapf(ErrTenantMismatch, "column %s", field.Name)
+		}
+
+		return nil
+	}
+
+	setFieldValue(fv, value)
+
+	return nil
+}
+
+// setRowTenants sets the tenant column of rows of table that are about to be
+// inserted.
+func setRowTenants(ctx context.Context, table *schema.Table, rows []reflect.Value) error {
+	for _, row := range rows {
+		err := setTenant(ctx, table, row.Elem())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ownedByTenant reports whether the row of model exists and belongs to the
+// tenant of ctx.
+func ownedByTenant(ctx context.Context, tx bun.IDB, table *schema.Table, model any) (bool, error) {
+	query := tx.NewSelect().Model(model).WherePK()
+
+	err := whereTenant(ctx, query, table)
+	if err != nil {
+		return false, err
+	}
+
+	exists, err := query.Exists(ctx)
+	if err != nil {
+		return false, errs.Wrap(err, "checking if model exists")
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,264 @@
+package bao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+type testTenantModel struct {
+	ID       string    `bun:",pk"`
+	TenantID uuid.UUID `bun:",type:uuid" bao:",tenant"`
+	Name     string
+}
+
+type testIntTenantModel struct {
+	ID       string `bun:",pk"`
+	TenantID int32  `bao:",tenant"`
+}
+
+// testTenants creates a model for each of two tenants and returns contexts
+// scoped to them.
+func testTenants(t *testing.T, db *bun.DB) (context.Context, *testTenantModel, context.Context, *testTenantModel) {
+	assert := assert.New(t)
+
+	ctx := WithTenant(context.Background(), uuid.New())
+	model := &testTenantModel{ID: uuid.New().String(), Name: "foo"}
+	err := Create(ctx, db, model, nil, nil)
+	assert.NoError(err)
+
+	otherCtx := WithTenant(context.Background(), uuid.New())
+	otherModel := &testTenantModel{ID: uuid.New().String(), Name: "bar"}
+	err = Create(otherCtx, db, otherModel, nil, nil)
+	assert.NoError(err)
+
+	return ctx, model, otherCtx, otherModel
+}
+
+func TestCreate_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	tenantID := uuid.New()
+
+	model := &testTenantModel{ID: uuid.New().String()}
+	err := Create(WithTenant(context.Background(), tenantID.String()), db, model, nil, nil)
+	assert.NoError(err)
+	assert.Equal(tenantID, model.TenantID)
+
+	stored := &testTenantModel{}
+	err = db.NewSelect().Model(stored).Where("id = ?", model.ID).Scan(context.Background())
+	assert.NoError(err)
+	assert.Equal(tenantID, stored.TenantID)
+}
+
+func TestCreate_tenant_mismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	model := &testTenantModel{ID: uuid.New().String(), TenantID: uuid.New()}
+	err := Create(WithTenant(context.Background(), uuid.New()), db, model, nil, nil)
+	assert.ErrorIs(err, ErrTenantMismatch)
+
+	err = CreateMany(WithTenant(context.Background(), uuid.New()), db, []*testTenantModel{model}, nil, nil)
+	assert.ErrorIs(err, ErrTenantMismatch)
+}
+
+func TestCreate_no_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	err := Create(context.Background(), db, &testTenantModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, ErrNoTenant)
+
+	err = Create(WithTenant(context.Background(), uuid.Nil), db, &testTenantModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, ErrNoTenant)
+}
+
+func TestCreate_invalid_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	err := Create(WithTenant(context.Background(), "foo"), db, &testTenantModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, ErrInvalidTenant)
+
+	err = Create(WithTenant(context.Background(), 1), db, &testTenantModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, ErrInvalidTenant)
+
+	model := &testIntTenantModel{ID: uuid.New().String()}
+	err = Create(WithTenant(context.Background(), int64(1)), db, model, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int32(1), model.TenantID)
+
+	// Converting would wrap around to tenant 1.
+	_, err = Find[testIntTenantModel](WithTenant(context.Background(), int64(4294967297)), db, nil)
+	assert.ErrorIs(err, ErrInvalidTenant)
+}
+
+func TestFind_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	ctx, model, _, otherModel := testTenants(t, db)
+
+	models, err := Find[testTenantModel](ctx, db, nil)
+	assert.NoError(err)
+	assert.Len(models, 1)
+	assert.Equal(model.ID, models[0].ID)
+
+	_, err = FindByID[testTenantModel](ctx, db, otherModel.ID, nil)
+	assert.ErrorIs(err, ErrNotFound)
+
+	_, err = FindByKey[testTenantModel](ctx, db, otherModel.ID, nil)
+	assert.ErrorIs(err, ErrNotFound)
+
+	models, count, err := FindAndCount[testTenantModel](ctx, db, nil, 10, 1)
+	assert.NoError(err)
+	assert.Empty(models)
+	assert.Equal(1, count)
+}
+
+func TestFind_no_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	_, model, _, _ := testTenants(t, db)
+
+	_, err := Find[testTenantModel](context.Background(), db, nil)
+	assert.ErrorIs(err, ErrNoTenant)
+
+	_, err = FindByID[testTenantModel](context.Background(), db, model.ID, nil)
+	assert.ErrorIs(err, ErrNoTenant)
+
+	_, _, err = Paginate[testTenantModel](context.Background(), db, nil, nil, "", 10)
+	assert.ErrorIs(err, ErrNoTenant)
+}
+
+func TestUpdate_other_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	ctx, _, otherCtx, otherModel := testTenants(t, db)
+
+	otherModel.Name = "baz"
+
+	err := Update(ctx, db, otherModel, nil, nil)
+	assert.ErrorIs(err, ErrTenantMismatch)
+
+	// The tenant column is filled in from ctx, so the row is not found.
+	err = Update(ctx, db, &testTenantModel{ID: otherModel.ID, Name: "baz"}, nil, nil)
+	assert.ErrorIs(err, ErrUpdateNotExists)
+
+	err = UpdateMany(ctx, db, []*testTenantModel{{ID: otherModel.ID, Name: "baz"}}, nil, nil)
+	assert.ErrorIs(err, ErrUpdateNotExists)
+
+	stored, err := FindByID[testTenantModel](otherCtx, db, otherModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("bar", stored.Name)
+}
+
+func TestUpsert_other_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	ctx, _, otherCtx, otherModel := testTenants(t, db)
+
+	err := Upsert(ctx, db, &testTenantModel{ID: otherModel.ID, Name: "baz"}, nil, nil, nil, nil)
+	assert.ErrorIs(err, ErrTenantMismatch)
+
+	err = Upsert(ctx, db, &testTenantModel{ID: otherModel.ID, Name: "baz"}, nil, []string{}, nil, nil)
+	assert.ErrorIs(err, ErrTenantMismatch)
+
+	stored, err := FindByID[testTenantModel](otherCtx, db, otherModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("bar", stored.Name)
+}
+
+func TestDelete_other_tenant(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	ctx, model, otherCtx, otherModel := testTenants(t, db)
+
+	var afterCalled bool
+	after := func(ctx context.Context, model *testTenantModel) {
+		afterCalled = true
+	}
+
+	err := Delete(ctx, db, &testTenantModel{ID: otherModel.ID}, nil, nil, []hook.After[testTenantModel]{after})
+	assert.ErrorIs(err, ErrNotFound)
+
+	err = DeleteMany(ctx, db, []*testTenantModel{model, {ID: otherModel.ID}}, nil, []hook.After[testTenantModel]{after})
+	assert.ErrorIs(err, ErrNotFound)
+
+	var modelErr *ModelError
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(1, modelErr.Index)
+	assert.False(afterCalled)
+
+	_, err = FindByID[testTenantModel](otherCtx, db, otherModel.ID, nil)
+	assert.NoError(err)
+
+	// The whole batch is rolled back.
+	_, err = FindByID[testTenantModel](ctx, db, model.ID, nil)
+	assert.NoError(err)
+
+	err = DeleteMany(ctx, db, []*testTenantModel{model}, nil, nil)
+	assert.NoError(err)
+
+	_, err = FindByID[testTenantModel](ctx, db, model.ID, nil)
+	assert.ErrorIs(err, ErrNotFound)
+
+	err = Delete(context.Background(), db, otherModel, nil, nil, nil)
+	assert.ErrorIs(err, ErrNoTenant)
+}
+
+func TestWithTenantParameter(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	tenantID := uuid.New()
+	ctx := WithTenant(context.Background(), tenantID, WithTenantParameter("myapp.tenant_id"))
+
+	var value string
+	err := Trx(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		var err error
+		value, err = hook.LocalParameter(ctx, tx, "myapp.tenant_id")
+		return err
+	})
+	assert.NoError(err)
+	assert.Equal(tenantID.String(), value)
+
+	_, err = Find[testTenantModel](ctx, db, func(q *bun.SelectQuery) {
+		q.Where("current_setting('myapp.tenant_id') = ?", tenantID.String())
+	})
+	assert.NoError(err)
+}
+
+func TestTenantFromContext(t *testing.T) {
+	assert := assert.New(t)
+
+	_, ok := TenantFromContext(context.Background())
+	assert.False(ok)
+
+	_, ok = TenantFromContext(WithTenant(context.Background(), ""))
+	assert.False(ok)
+
+	tenantID, ok := TenantFromContext(WithTenant(context.Background(), "tenant-1"))
+	assert.True(ok)
+	assert.Equal("tenant-1", tenantID)
+}
@@ -0,0 +1,107 @@
+package bao
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/eleanorhealth/go-common/pkg/clock"
+	"github.com/uptrace/bun/schema"
+)
+
+type clockKey struct{}
+
+// WithClock returns a copy of ctx that makes bao take the current time from c,
+// e.g. to pin the timestamps bao writes in tests.
+func WithClock(ctx context.Context, c clock.Clocker) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+func now(ctx context.Context) time.Time {
+	c, ok := ctx.Value(clockKey{}).(clock.Clocker)
+	if !ok {
+		return time.Now()
+	}
+
+	return c.Now()
+}
+
+// createdAtField returns the column tagged bao:",createdat" or nil if there is
+// none.
+func createdAtField(table *schema.Table) *schema.Field {
+	return taggedField(table, "createdat")
+}
+
+// updatedAtField returns the column tagged bao:",updatedat" or nil if there is
+// none.
+func updatedAtField(table *schema.Table) *schema.Field {
+	return taggedField(table, "updatedat")
+}
+
+// updatableFields returns the columns of table that an update writes: all but
+// the createdat column, which keeps the time the row was created.
+func updatableFields(table *schema.Table) []*schema.Field {
+	created := createdAtField(table)
+
+	return slices.DeleteFunc(slices.Clone(table.Fields), func(field *schema.Field) bool {
+		return field == created
+	})
+}
+
+// bulkUpdateColumns returns the names of the columns that a bulk update of
+// table sets.
+func bulkUpdateColumns(table *schema.Table) []string {
+	var names []string
+	for _, field := range updatableFields(table) {
+		if !field.IsPK {
+			names = append(names, field.Name)
+		}
+	}
+
+	return names
+}
+
+// setCreatedTimestamps sets the updatedat column of strct to t, and the
+// createdat column if it is zero so that rows can be backfilled with their
+// original creation time.
+func setCreatedTimestamps(table *schema.Table, strct reflect.Value, t time.Time) error {
+	if field := createdAtField(table); field != nil && field.HasZeroValue(strct) {
+		err := setTimeField(field, strct, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setUpdatedTimestamp(table, strct, t)
+}
+
+// setUpdatedTimestamp sets the updatedat column of strct to t.
+func setUpdatedTimestamp(table *schema.Table, strct reflect.Value, t time.Time) error {
+	field := updatedAtField(table)
+	if field == nil {
+		return nil
+	}
+
+	return setTimeField(field, strct, t)
+}
+
+// setRowTimestamps sets the timestamps of rows of table that are about to be
+// inserted, or updated when created is false.
+func setRowTimestamps(ctx context.Context, table *schema.Table, rows []reflect.Value, created bool) error {
+	t := now(ctx)
+
+	for _, row := range rows {
+		var err error
+		if created {
+			err = setCreatedTimestamps(table, row.Elem(), t)
+		} else {
+			err = setUpdatedTimestamp(table, row.Elem(), t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
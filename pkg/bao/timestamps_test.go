@@ -0,0 +1,247 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+type testTimestampModel struct {
+	ID        string `bun:",pk"`
+	Name      string
+	CreatedAt time.Time `bao:",createdat"`
+	UpdatedAt time.Time `bao:",updatedat"`
+}
+
+type testPointerTimestampModel struct {
+	ID        string        `bun:",pk"`
+	CreatedAt *sql.NullTime `bao:",createdat"`
+	UpdatedAt *bun.NullTime `bao:",updatedat"`
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func testClockContext() (context.Context, *testClock) {
+	c := &testClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	return WithClock(context.Background(), c), c
+}
+
+func TestCreate_timestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	insertModel := &testTimestampModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+	assert.Equal(c.now, insertModel.CreatedAt)
+	assert.Equal(c.now, insertModel.UpdatedAt)
+
+	model, err := FindByID[testTimestampModel](ctx, db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.True(c.now.Equal(model.CreatedAt))
+	assert.True(c.now.Equal(model.UpdatedAt))
+}
+
+func TestCreate_timestamps_created_at_set(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	createdAt := c.now.Add(-time.Hour)
+
+	insertModel := &testTimestampModel{
+		ID:        uuid.New().String(),
+		CreatedAt: createdAt,
+	}
+	err := Create(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+	assert.Equal(createdAt, insertModel.CreatedAt)
+	assert.Equal(c.now, insertModel.UpdatedAt)
+}
+
+func TestUpdate_timestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	insertModel := &testTimestampModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	createdAt := c.now
+	c.now = c.now.Add(time.Minute)
+
+	insertModel.Name = "foo"
+	err = Update(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+	assert.Equal(createdAt, insertModel.CreatedAt)
+	assert.Equal(c.now, insertModel.UpdatedAt)
+
+	model, err := FindByID[testTimestampModel](ctx, db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.True(createdAt.Equal(model.CreatedAt))
+	assert.True(c.now.Equal(model.UpdatedAt))
+}
+
+func TestUpdate_timestamps_created_at_unset(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	insertModel := &testTimestampModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	createdAt := c.now
+	c.now = c.now.Add(time.Minute)
+
+	// A model built from a request payload has no CreatedAt.
+	err = Update(ctx, db, &testTimestampModel{ID: insertModel.ID, Name: "foo"}, nil, nil)
+	assert.NoError(err)
+
+	err = UpdateMany(ctx, db, []*testTimestampModel{{ID: insertModel.ID, Name: "bar"}}, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testTimestampModel](ctx, db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("bar", model.Name)
+	assert.True(createdAt.Equal(model.CreatedAt))
+	assert.True(c.now.Equal(model.UpdatedAt))
+}
+
+func TestUpdateColumns_timestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	insertModel := &testTimestampModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	c.now = c.now.Add(time.Minute)
+
+	insertModel.Name = "foo"
+	err = UpdateColumns(ctx, db, insertModel, []string{"name"}, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testTimestampModel](ctx, db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+	assert.True(c.now.Equal(model.UpdatedAt))
+}
+
+func TestUpsert_timestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	id := uuid.New().String()
+
+	err := Upsert(ctx, db, &testTimestampModel{ID: id}, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	createdAt := c.now
+	c.now = c.now.Add(time.Minute)
+
+	err = Upsert(ctx, db, &testTimestampModel{ID: id, Name: "foo"}, nil, nil, nil, nil)
+	assert.NoError(err)
+
+	model, err := FindByID[testTimestampModel](ctx, db, id, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+	assert.True(createdAt.Equal(model.CreatedAt))
+	assert.True(c.now.Equal(model.UpdatedAt))
+}
+
+func TestCreateMany_UpdateMany_timestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	models := []*testTimestampModel{{ID: uuid.New().String()}, {ID: uuid.New().String()}}
+	err := CreateMany(ctx, db, models, nil, nil)
+	assert.NoError(err)
+
+	createdAt := c.now
+	c.now = c.now.Add(time.Minute)
+
+	err = UpdateMany(ctx, db, models, nil, nil)
+	assert.NoError(err)
+
+	for _, model := range models {
+		assert.Equal(createdAt, model.CreatedAt)
+		assert.Equal(c.now, model.UpdatedAt)
+	}
+}
+
+func TestDelete_soft_delete_clock(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	insertModel := &testSoftDeleteModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(ctx, db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	err = Delete(ctx, db, insertModel, nil, nil, nil)
+	assert.NoError(err)
+	assert.Equal(c.now, insertModel.DeletedAt)
+}
+
+func TestCreate_timestamps_pointer(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+	ctx, c := testClockContext()
+
+	model := &testPointerTimestampModel{ID: uuid.New().String()}
+	err := Create(ctx, db, model, nil, nil)
+	assert.NoError(err)
+	assert.Equal(&sql.NullTime{Time: c.now, Valid: true}, model.CreatedAt)
+	assert.Equal(&bun.NullTime{Time: c.now}, model.UpdatedAt)
+}
+
+func TestCreate_timestamps_not_time(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	type testInvalidTimestampModel struct {
+		ID        string `bun:",pk"`
+		UpdatedAt string `bao:",updatedat"`
+	}
+
+	err := Create(context.Background(), db, &testInvalidTimestampModel{ID: uuid.New().String()}, nil, nil)
+	assert.ErrorIs(err, ErrFieldNotTime)
+}
@@ -0,0 +1,265 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/uptrace/bun"
+)
+
+// RetryPolicy controls how TrxWithOptions re-runs a transaction that failed
+// with a serialization failure or a deadlock.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times the transaction is run,
+	// including the first attempt.
+	Attempts uint
+	// Delay is the base delay between attempts. It grows exponentially and is
+	// jittered.
+	Delay time.Duration
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Delay:    50 * time.Millisecond,
+	MaxDelay: time.Second,
+}
+
+type trxOptions struct {
+	txOptions       sql.TxOptions
+	deferrable      bool
+	retryPolicy     *RetryPolicy
+	localParameters map[string]string
+}
+
+type TrxOption func(o *trxOptions)
+
+func WithIsolationLevel(level sql.IsolationLevel) TrxOption {
+	return func(o *trxOptions) {
+		o.txOptions.Isolation = level
+	}
+}
+
+func WithReadOnly() TrxOption {
+	return func(o *trxOptions) {
+		o.txOptions.ReadOnly = true
+	}
+}
+
+// WithDeferrable marks the transaction DEFERRABLE. Postgres only honors it for
+// SERIALIZABLE READ ONLY transactions.
+func WithDeferrable() TrxOption {
+	return func(o *trxOptions) {
+		o.deferrable = true
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) TrxOption {
+	return func(o *trxOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithLocalParameters sets the Postgres parameters params with SET LOCAL at the
+// start of the transaction, e.g. to feed the acting user into row level
+// security policies and triggers. Unlike the other options it also applies to
+// savepoints, where the parameters are reverted if the savepoint is rolled
+// back.
+func WithLocalParameters(params map[string]string) TrxOption {
+	params = maps.Clone(params)
+
+	return func(o *trxOptions) {
+		o.localParameters = params
+	}
+}
+
+type trxStateKey struct{}
+
+// trxState holds the callbacks queued on a transaction or savepoint.
+type trxState struct {
+	parent        *trxState
+	afterCommit   []func(ctx context.Context)
+	afterRollback []func(ctx context.Context)
+}
+
+// commit runs the queued after commit callbacks, or hands all callbacks to the
+// enclosing transaction when state belongs to a savepoint.
+func (s *trxState) commit(ctx context.Context) {
+	if s.parent != nil {
+		s.parent.afterCommit = append(s.parent.afterCommit, s.afterCommit...)
+		s.parent.afterRollback = append(s.parent.afterRollback, s.afterRollback...)
+
+		return
+	}
+
+	for _, fn := range s.afterCommit {
+		fn(ctx)
+	}
+}
+
+func (s *trxState) rollback(ctx context.Context) {
+	for _, fn := range s.afterRollback {
+		fn(ctx)
+	}
+}
+
+// AfterCommit queues fn to run once the outermost transaction started by Trx
+// has been committed. fn is dropped if the transaction, or the savepoint ctx
+// belongs to, is rolled back. fn runs immediately when ctx does not belong to a
+// transaction started by Trx.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	state, ok := ctx.Value(trxStateKey{}).(*trxState)
+	if !ok {
+		fn(ctx)
+		return
+	}
+
+	state.afterCommit = append(state.afterCommit, fn)
+}
+
+// AfterRollback queues fn to run once the transaction, or the savepoint ctx
+// belongs to, has been rolled back. fn is dropped when ctx does not belong to a
+// transaction started by Trx.
+func AfterRollback(ctx context.Context, fn func(ctx context.Context)) {
+	state, ok := ctx.Value(trxStateKey{}).(*trxState)
+	if !ok {
+		return
+	}
+
+	state.afterRollback = append(state.afterRollback, fn)
+}
+
+func Trx(ctx context.Context, db bun.IDB, fn func(ctx context.Context, tx bun.IDB) error) error {
+	return TrxWithOptions(ctx, db, fn)
+}
+
+// TrxWithOptions is like Trx but lets the caller configure the transaction and
+// retry it on serialization failures (40001) and deadlocks (40P01).
+//
+// Options other than WithLocalParameters only apply when db is a *bun.DB. When
+// db is already a bun.Tx, fn runs in a savepoint of that transaction and is
+// never retried: a serialization failure aborts the whole outer transaction,
+// so the error is returned for the owner of the outer transaction to retry.
+func TrxWithOptions(ctx context.Context, db bun.IDB, fn func(ctx context.Context, tx bun.IDB) error, opts ...TrxOption) error {
+	o := &trxOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if _, ok := db.(*bun.DB); !ok || o.retryPolicy == nil {
+		return trx(ctx, db, o, fn)
+	}
+
+	attempts := o.retryPolicy.Attempts
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	var trxErr error
+	err := retry.Do(
+		func() error {
+			trxErr = trx(ctx, db, o, fn)
+			return trxErr
+		},
+		retry.Attempts(attempts),
+		retry.Delay(o.retryPolicy.Delay),
+		retry.MaxDelay(o.retryPolicy.MaxDelay),
+		retry.RetryIf(isRetryableTrxError),
+		retry.Context(ctx),
+		retry.LastErrorOnly(true),
+	)
+
+	// When ctx is done during the backoff, retry only returns the context
+	// error. Keep the error that caused the retry.
+	if err != nil && trxErr != nil && !errors.Is(err, trxErr) {
+		return errors.Join(trxErr, err)
+	}
+
+	return err
+}
+
+func trx(ctx context.Context, db bun.IDB, o *trxOptions, fn func(ctx context.Context, tx bun.IDB) error) error {
+	var tx bun.Tx
+	var err error
+
+	state := &trxState{}
+
+	switch db := db.(type) {
+	case bun.Tx:
+		state.parent, _ = ctx.Value(trxStateKey{}).(*trxState)
+
+		// Nested transaction. bun creates a savepoint that is released on
+		// success and rolled back to on error, leaving the outer transaction
+		// usable.
+		tx, err = db.BeginTx(ctx, nil)
+		if err != nil {
+			return errs.Wrap(err, "creating savepoint")
+		}
+
+	case *bun.DB:
+		tx, err = db.BeginTx(ctx, &o.txOptions)
+		if err != nil {
+			return errs.Wrap(err, "beginning transaction")
+		}
+
+	default:
+		return errors.New("unknown type: %s")
+	}
+
+	// Rolling back to a savepoint that has already been released fails and
+	// aborts the outer transaction, so only roll back if fn did not succeed.
+	var done bool
+	defer func() {
+		if !done {
+			//nolint
+			tx.Rollback()
+			state.rollback(ctx)
+		}
+	}()
+
+	if _, ok := db.(*bun.DB); ok && o.deferrable {
+		_, err = tx.ExecContext(ctx, "SET TRANSACTION DEFERRABLE")
+		if err != nil {
+			return errs.Wrap(err, "setting transaction deferrable")
+		}
+	}
+
+	params := o.localParameters
+	if name, value, ok := tenantParameter(ctx); ok {
+		params = maps.Clone(params)
+		if params == nil {
+			params = make(map[string]string, 1)
+		}
+
+		params[name] = value
+	}
+
+	err = hook.SetLocalParameters(ctx, tx, params)
+	if err != nil {
+		return err
+	}
+
+	err = fn(context.WithValue(ctx, trxStateKey{}, state), tx)
+	if err != nil {
+		return err
+	}
+
+	done = true
+
+	err = tx.Commit()
+	if err != nil {
+		state.rollback(ctx)
+		return errs.Wrap(err, "committing transaction")
+	}
+
+	state.commit(ctx)
+
+	return nil
+}
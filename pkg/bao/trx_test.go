@@ -0,0 +1,394 @@
+package bao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eleanorhealth/go-common/pkg/bao/hook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+var testRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Delay:    time.Millisecond,
+}
+
+func raiseSQLState(ctx context.Context, db bun.IDB, code string) error {
+	_, err := db.ExecContext(ctx, "DO $$ BEGIN RAISE EXCEPTION 'test' USING ERRCODE = '"+code+"'; END $$")
+	return err
+}
+
+func TestTrxWithOptions_isolation_level(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var isolation string
+	var readOnly string
+	var deferrable string
+
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		err := tx.QueryRowContext(ctx, "SHOW transaction_isolation").Scan(&isolation)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, "SHOW transaction_read_only").Scan(&readOnly)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, "SHOW transaction_deferrable").Scan(&deferrable)
+	}, WithIsolationLevel(sql.LevelSerializable), WithReadOnly(), WithDeferrable())
+	assert.NoError(err)
+
+	assert.Equal("serializable", isolation)
+	assert.Equal("on", readOnly)
+	assert.Equal("on", deferrable)
+}
+
+func TestTrxWithOptions_retry_serialization_failure(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testModel{
+		ID: uuid.New().String(),
+	}
+
+	var attempts int
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		attempts++
+
+		_, err := tx.NewInsert().Model(insertModel).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		if attempts == 1 {
+			return raiseSQLState(ctx, tx, pgCodeSerializationFailure)
+		}
+
+		return nil
+	}, WithIsolationLevel(sql.LevelSerializable), WithRetryPolicy(testRetryPolicy))
+	assert.NoError(err)
+	assert.Equal(2, attempts)
+
+	count, err := db.NewSelect().Model((*testModel)(nil)).Where("id = ?", insertModel.ID).Count(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, count)
+}
+
+func TestTrxWithOptions_retry_deadlock(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var attempts int
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		attempts++
+
+		if attempts < 3 {
+			return raiseSQLState(ctx, tx, pgCodeDeadlockDetected)
+		}
+
+		return nil
+	}, WithRetryPolicy(testRetryPolicy))
+	assert.NoError(err)
+	assert.Equal(3, attempts)
+}
+
+func TestTrxWithOptions_retry_attempts_exhausted(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var attempts int
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		attempts++
+
+		return raiseSQLState(ctx, tx, pgCodeSerializationFailure)
+	}, WithRetryPolicy(testRetryPolicy))
+	assert.True(isRetryableTrxError(err))
+	assert.Equal(3, attempts)
+}
+
+func TestTrxWithOptions_retry_context_done(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var attempts int
+	err := TrxWithOptions(ctx, db, func(ctx context.Context, tx bun.IDB) error {
+		attempts++
+
+		err := raiseSQLState(ctx, tx, pgCodeSerializationFailure)
+		cancel()
+
+		return err
+	}, WithRetryPolicy(RetryPolicy{Attempts: 3, Delay: time.Minute}))
+	assert.ErrorIs(err, context.Canceled)
+	assert.True(isRetryableTrxError(err))
+	assert.Equal(1, attempts)
+}
+
+func TestTrxWithOptions_no_retry_other_errors(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	fnErr := errors.New("test")
+
+	var attempts int
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		attempts++
+
+		return fnErr
+	}, WithRetryPolicy(testRetryPolicy))
+	assert.ErrorIs(err, fnErr)
+	assert.Equal(1, attempts)
+}
+
+func TestTrxWithOptions_no_retry_nested(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var outerAttempts int
+	var innerAttempts int
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		outerAttempts++
+
+		return TrxWithOptions(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			innerAttempts++
+
+			if outerAttempts == 1 {
+				return raiseSQLState(ctx, tx, pgCodeSerializationFailure)
+			}
+
+			return nil
+		}, WithRetryPolicy(testRetryPolicy))
+	}, WithRetryPolicy(testRetryPolicy))
+	assert.NoError(err)
+
+	// The inner block is re-run by the outer transaction, not by itself.
+	assert.Equal(2, outerAttempts)
+	assert.Equal(2, innerAttempts)
+}
+
+func TestTrxWithOptions_local_parameters(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	params := map[string]string{
+		"myapp.user_id": "user-1",
+	}
+
+	var outer, inner, afterRollback string
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		var err error
+		outer, err = hook.LocalParameter(ctx, tx, "myapp.user_id")
+		if err != nil {
+			return err
+		}
+
+		testErr := TrxWithOptions(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			inner, err = hook.LocalParameter(ctx, tx, "myapp.user_id")
+			if err != nil {
+				return err
+			}
+
+			return errors.New("test")
+		}, WithLocalParameters(map[string]string{"myapp.user_id": "user-2"}))
+		assert.Error(testErr)
+
+		// Rolling back to the savepoint reverts its parameters.
+		afterRollback, err = hook.LocalParameter(ctx, tx, "myapp.user_id")
+		return err
+	}, WithLocalParameters(params))
+	assert.NoError(err)
+
+	assert.Equal("user-1", outer)
+	assert.Equal("user-2", inner)
+	assert.Equal("user-1", afterRollback)
+
+	// The parameters do not outlive the transaction.
+	value, err := hook.LocalParameter(context.Background(), db, "myapp.user_id")
+	assert.NoError(err)
+	assert.Empty(value)
+}
+
+func TestTrxWithOptions_local_parameters_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var called bool
+	err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		called = true
+		return nil
+	}, WithLocalParameters(map[string]string{`myapp.user_id" = 'x'; DROP TABLE test_models; --`: "x"}))
+	assert.ErrorIs(err, hook.ErrInvalidLocalParameter)
+	assert.False(called)
+}
+
+func TestAfterCommit(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	var calls []string
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		AfterCommit(ctx, func(ctx context.Context) {
+			calls = append(calls, "outer")
+		})
+
+		err := Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			AfterCommit(ctx, func(ctx context.Context) {
+				calls = append(calls, "inner")
+			})
+
+			return nil
+		})
+		assert.NoError(err)
+
+		// Nothing runs before the outermost transaction commits.
+		assert.Empty(calls)
+
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"outer", "inner"}, calls)
+}
+
+func TestAfterCommit_rollback(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	fnErr := errors.New("test")
+
+	var committed bool
+	var rolledBack bool
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		err := Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			AfterCommit(ctx, func(ctx context.Context) {
+				committed = true
+			})
+			AfterRollback(ctx, func(ctx context.Context) {
+				rolledBack = true
+			})
+
+			return nil
+		})
+		assert.NoError(err)
+
+		return fnErr
+	})
+	assert.ErrorIs(err, fnErr)
+	assert.False(committed)
+	assert.True(rolledBack)
+}
+
+func TestAfterCommit_savepoint_rollback(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	fnErr := errors.New("test")
+
+	var calls []string
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		AfterCommit(ctx, func(ctx context.Context) {
+			calls = append(calls, "outer")
+		})
+
+		err := Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			AfterCommit(ctx, func(ctx context.Context) {
+				calls = append(calls, "inner")
+			})
+			AfterRollback(ctx, func(ctx context.Context) {
+				calls = append(calls, "inner rollback")
+			})
+
+			return fnErr
+		})
+		assert.ErrorIs(err, fnErr)
+		assert.Equal([]string{"inner rollback"}, calls)
+
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"inner rollback", "outer"}, calls)
+}
+
+func TestAfterCommit_no_transaction(t *testing.T) {
+	assert := assert.New(t)
+
+	var called bool
+	AfterCommit(context.Background(), func(ctx context.Context) {
+		called = true
+	})
+	assert.True(called)
+}
+
+func TestCreate_after_hook_outer_rollback(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	fnErr := errors.New("test")
+
+	var afterCalled bool
+	afterCreate := func(ctx context.Context, model *testModel) {
+		afterCalled = true
+	}
+
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		err := Create(ctx, tx, &testModel{ID: uuid.New().String()}, nil, []hook.After[testModel]{afterCreate})
+		assert.NoError(err)
+		assert.False(afterCalled)
+
+		return fnErr
+	})
+	assert.ErrorIs(err, fnErr)
+	assert.False(afterCalled)
+}
+
+func TestCreate_after_hook_context(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	type testKey struct{}
+
+	var value any
+	var committed bool
+	afterCreate := func(ctx context.Context, model *testModel) {
+		value = ctx.Value(testKey{})
+
+		// The transaction has been committed, so this runs immediately.
+		AfterCommit(ctx, func(ctx context.Context) {
+			committed = true
+		})
+	}
+
+	err := Trx(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+		return Trx(ctx, tx, func(ctx context.Context, tx bun.IDB) error {
+			ctx = context.WithValue(ctx, testKey{}, "foo")
+			return Create(ctx, tx, &testModel{ID: uuid.New().String()}, nil, []hook.After[testModel]{afterCreate})
+		})
+	})
+	assert.NoError(err)
+	assert.Equal("foo", value)
+	assert.True(committed)
+}
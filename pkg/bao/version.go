@@ -0,0 +1,85 @@
+package bao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/eleanorhealth/go-common/pkg/errs"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// versionField returns the column tagged bao:",version" or nil if the model
+// does not use optimistic concurrency control.
+func versionField(table *schema.Table) *schema.Field {
+	return taggedField(table, "version")
+}
+
+// bumpVersion increments the version column of strct and returns the previous
+// version. The previous version is put back if the transaction of ctx, or one
+// enclosing it, is rolled back, so that a retried transaction writes the
+// version the model was read with again.
+func bumpVersion(ctx context.Context, field *schema.Field, strct reflect.Value) (any, error) {
+	fv := field.Value(strct)
+	old := fv.Interface()
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		restoreOnRollback(ctx, field, strct)
+		fv.SetInt(fv.Int() + 1)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		restoreOnRollback(ctx, field, strct)
+		fv.SetUint(fv.Uint() + 1)
+
+	default:
+		return nil, errs.Wrapf(ErrFieldNotInteger, "column %s", field.Name)
+	}
+
+	return old, nil
+}
+
+// restoreOnRollback puts the current value of field of strct back if the
+// transaction of ctx, or one enclosing it, is rolled back.
+func restoreOnRollback(ctx context.Context, field *schema.Field, strct reflect.Value) {
+	fv := field.Value(strct)
+
+	old := reflect.New(fv.Type()).Elem()
+	old.Set(fv)
+
+	AfterRollback(ctx, func(context.Context) {
+		fv.Set(old)
+	})
+}
+
+// staleModelIndex returns the index of the first model whose version in the
+// database no longer matches the version it was read with, or ErrStaleModel
+// if there is none.
+func staleModelIndex[ModelT any](ctx context.Context, tx bun.IDB, table *schema.Table, field *schema.Field, models []*ModelT, oldVersions []any) (int, error) {
+	columns := make([]string, 0, len(table.PKs)+1)
+	for _, pk := range table.PKs {
+		columns = append(columns, pk.Name)
+	}
+	columns = append(columns, field.Name)
+
+	var current []*ModelT
+	err := tx.NewSelect().Model(&models).Column(columns...).WherePK().Scan(ctx, &current)
+	if err != nil {
+		return 0, errs.Wrap(err, "selecting model versions")
+	}
+
+	currentVersions := make(map[string]string, len(current))
+	for _, model := range current {
+		strct := reflect.ValueOf(model).Elem()
+		currentVersions[pkKey(table, strct)] = fmt.Sprint(field.Value(strct).Interface())
+	}
+
+	for i, model := range models {
+		if currentVersions[pkKey(table, reflect.ValueOf(model).Elem())] != fmt.Sprint(oldVersions[i]) {
+			return i, nil
+		}
+	}
+
+	return 0, errs.Wrap(ErrStaleModel, "no model version differs")
+}
@@ -0,0 +1,242 @@
+package bao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+type testVersionModel struct {
+	ID      string `bun:",pk"`
+	Name    string
+	Version int64 `bao:",version"`
+}
+
+func TestUpdate_version(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testVersionModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	insertModel.Name = "foo"
+
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int64(1), insertModel.Version)
+
+	err = Update(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int64(2), insertModel.Version)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+}
+
+func TestUpdate_version_stale(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testVersionModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	first, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+
+	second, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+
+	first.Name = "foo"
+	err = Update(context.Background(), db, first, nil, nil)
+	assert.NoError(err)
+
+	second.Name = "bar"
+	err = Update(context.Background(), db, second, nil, nil)
+	assert.ErrorIs(err, ErrStaleModel)
+
+	// The in-memory version is left untouched when the update fails.
+	assert.Equal(int64(0), second.Version)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+	assert.Equal(int64(1), model.Version)
+}
+
+func TestUpdateColumns_version(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testVersionModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	stale, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+
+	insertModel.Name = "foo"
+	err = UpdateColumns(context.Background(), db, insertModel, []string{"name"}, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int64(1), insertModel.Version)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+
+	stale.Name = "bar"
+	err = UpdateColumns(context.Background(), db, stale, []string{"name"}, nil, nil)
+	assert.ErrorIs(err, ErrStaleModel)
+}
+
+func TestUpdateMany_version(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModels := []*testVersionModel{
+		{ID: uuid.New().String()},
+		{ID: uuid.New().String(), Version: 5},
+	}
+	err := CreateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	err = UpdateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int64(1), insertModels[0].Version)
+	assert.Equal(int64(6), insertModels[1].Version)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModels[1].ID, nil)
+	assert.NoError(err)
+	assert.Equal(int64(6), model.Version)
+}
+
+func TestUpdateMany_version_stale(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModels := []*testVersionModel{
+		{ID: uuid.New().String()},
+		{ID: uuid.New().String()},
+	}
+	err := CreateMany(context.Background(), db, insertModels, nil, nil)
+	assert.NoError(err)
+
+	concurrent, err := FindByID[testVersionModel](context.Background(), db, insertModels[1].ID, nil)
+	assert.NoError(err)
+
+	err = Update(context.Background(), db, concurrent, nil, nil)
+	assert.NoError(err)
+
+	insertModels[0].Name = "foo"
+	insertModels[1].Name = "bar"
+
+	err = UpdateMany(context.Background(), db, insertModels, nil, nil)
+	assert.ErrorIs(err, ErrStaleModel)
+
+	modelErr := &ModelError{}
+	assert.ErrorAs(err, &modelErr)
+	assert.Equal(1, modelErr.Index)
+
+	assert.Equal(int64(0), insertModels[0].Version)
+	assert.Equal(int64(0), insertModels[1].Version)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModels[0].ID, nil)
+	assert.NoError(err)
+	assert.Empty(model.Name)
+}
+
+func TestUpsert_version(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testVersionModel{
+		ID: uuid.New().String(),
+	}
+	err := Upsert(context.Background(), db, insertModel, nil, nil, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int64(0), insertModel.Version)
+
+	upsertModel := &testVersionModel{ID: insertModel.ID, Name: "foo"}
+	err = Upsert(context.Background(), db, upsertModel, nil, nil, nil, nil)
+	assert.NoError(err)
+	assert.Equal(int64(1), upsertModel.Version)
+
+	// insertModel was read before the upsert above.
+	insertModel.Name = "bar"
+	err = Upsert(context.Background(), db, insertModel, nil, nil, nil, nil)
+	assert.ErrorIs(err, ErrStaleModel)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal("foo", model.Name)
+	assert.Equal(int64(1), model.Version)
+}
+
+func TestUpdate_version_retry(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDB(t)
+
+	insertModel := &testVersionModel{
+		ID: uuid.New().String(),
+	}
+	err := Create(context.Background(), db, insertModel, nil, nil)
+	assert.NoError(err)
+
+	retry := func(fn func(ctx context.Context, tx bun.IDB) error) {
+		var attempts int
+		err := TrxWithOptions(context.Background(), db, func(ctx context.Context, tx bun.IDB) error {
+			attempts++
+
+			err := fn(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			// The write succeeded but the transaction does not commit.
+			if attempts == 1 {
+				return raiseSQLState(ctx, tx, pgCodeSerializationFailure)
+			}
+
+			return nil
+		}, WithRetryPolicy(testRetryPolicy))
+		assert.NoError(err)
+		assert.Equal(2, attempts)
+	}
+
+	retry(func(ctx context.Context, tx bun.IDB) error {
+		return Update(ctx, tx, insertModel, nil, nil)
+	})
+	assert.Equal(int64(1), insertModel.Version)
+
+	retry(func(ctx context.Context, tx bun.IDB) error {
+		return UpdateMany(ctx, tx, []*testVersionModel{insertModel}, nil, nil)
+	})
+	assert.Equal(int64(2), insertModel.Version)
+
+	retry(func(ctx context.Context, tx bun.IDB) error {
+		return Upsert(ctx, tx, insertModel, nil, nil, nil, nil)
+	})
+	assert.Equal(int64(3), insertModel.Version)
+
+	model, err := FindByID[testVersionModel](context.Background(), db, insertModel.ID, nil)
+	assert.NoError(err)
+	assert.Equal(insertModel, model)
+}